@@ -0,0 +1,148 @@
+// Fetch from several mail accounts in one run, e.g. when the reports for
+// different properties arrive at different addresses.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+)
+
+// IMAPAccount holds the login for one mail account. Empty fields take their
+// values from the top-level Config.
+type IMAPAccount struct {
+	Name                     string   `json:"name"`
+	Provider                 string   `json:"provider"`
+	IMAPHost                 string   `json:"imap_host"`
+	IMAPPort                 int      `json:"imap_port"`
+	YahooUsername            string   `json:"yahoo_username"`
+	YahooAppPassword         string   `json:"yahoo_app_password"`
+	AuthMethods              []string `json:"auth_methods"`
+	AuthMethod               string   `json:"auth_method"`
+	IMAPOAuthTokenFile       string   `json:"imap_oauth_token_file"`
+	IMAPOAuthCredentialsFile string   `json:"imap_oauth_credentials_file"`
+	Mailboxes                []string `json:"mailboxes"`
+}
+
+// Return a Config for each account to fetch from, with the account's
+// settings overriding the others. With no accounts configured, the config
+// describes the single account.
+func accountConfigs(config *Config) []*Config {
+	if len(config.Accounts) == 0 {
+		return []*Config{config}
+	}
+
+	var configs []*Config
+	for _, a := range config.Accounts {
+		c := *config
+		c.Accounts = nil
+		c.AccountName = a.Name
+		if a.Provider != "" {
+			c.Provider = a.Provider
+			c.IMAPHost = ""
+			c.IMAPPort = 0
+		}
+		if a.IMAPHost != "" {
+			c.IMAPHost = a.IMAPHost
+		}
+		if a.IMAPPort != 0 {
+			c.IMAPPort = a.IMAPPort
+		}
+		if a.YahooUsername != "" {
+			c.YahooUsername = a.YahooUsername
+		}
+		if a.YahooAppPassword != "" {
+			c.YahooAppPassword = a.YahooAppPassword
+		}
+		if len(a.AuthMethods) > 0 || a.AuthMethod != "" {
+			c.AuthMethods = a.AuthMethods
+			c.AuthMethod = a.AuthMethod
+		}
+		if a.IMAPOAuthTokenFile != "" {
+			c.IMAPOAuthTokenFile = a.IMAPOAuthTokenFile
+		}
+		if a.IMAPOAuthCredentialsFile != "" {
+			c.IMAPOAuthCredentialsFile = a.IMAPOAuthCredentialsFile
+		}
+		if len(a.Mailboxes) > 0 {
+			c.Mailboxes = a.Mailboxes
+		}
+		// UIDs are only unique within an account, so each has its own cache.
+		if c.CacheDir != "" {
+			c.CacheDir = filepath.Join(c.CacheDir, url.PathEscape(a.Name))
+		}
+		configs = append(configs, &c)
+	}
+	return configs
+}
+
+// Fetch the emails from each account, tagging each with its account, and
+// merge them. As across mailboxes, only the first copy of each Message-Id
+// is kept. With useUIDState, mailboxes with a UID in the state file are
+// searched for later UIDs.
+func getAccountEmails(ctx context.Context, config *Config, subject string, since, before time.Time, useUIDState bool) ([]*EmailMessage, error) {
+	var merged []*EmailMessage
+	seen := make(map[string]bool)
+	for _, account := range accountConfigs(config) {
+		if account.AccountName != "" {
+			fmt.Printf("Fetching from account %s (%s)\n", account.AccountName, account.YahooUsername)
+		}
+		var lastUIDs map[string]uidState
+		if useUIDState {
+			var err error
+			if lastUIDs, err = propertyUIDStates(account); err != nil {
+				return merged, err
+			}
+		}
+		emails, err := getYahooEmails(ctx, account, subject, since, before, lastUIDs)
+		for _, email := range emails {
+			email.Account = account.AccountName
+			if email.MessageID != "" {
+				if seen[email.MessageID] {
+					fmt.Printf("Email %s was already found in another account; skipping.\n", email.MessageID)
+					continue
+				}
+				seen[email.MessageID] = true
+			}
+			merged = append(merged, email)
+		}
+		if err != nil {
+			if account.AccountName != "" {
+				err = fmt.Errorf("account %s: %v", account.AccountName, err)
+			}
+			return merged, err
+		}
+	}
+	return merged, nil
+}
+
+// Mark the recorded emails as processed in the accounts they came from; see
+// zillow.MarkProcessed.
+func markProcessedEmails(ctx context.Context, config *Config, recorded []*EmailMessage) error {
+	for _, account := range accountConfigs(config) {
+		var emails []*EmailMessage
+		for _, email := range recorded {
+			if email.Account == account.AccountName {
+				emails = append(emails, email)
+			}
+		}
+		if len(emails) == 0 {
+			continue
+		}
+		auth, timeouts, retry, err := imapSettings(ctx, account)
+		if err == nil {
+			err = zillow.MarkProcessed(ctx, account.imapAddr(), auth, timeouts, retry, emails, account.ProcessedMailbox)
+		}
+		if err != nil {
+			if account.AccountName != "" {
+				err = fmt.Errorf("account %s: %v", account.AccountName, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Record a line per run in an audit log, and report on recent runs.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// auditEntry is one run's record in the audit log, stored as a line of JSON.
+type auditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Version    string    `json:"version"`
+	Property   string    `json:"property,omitempty"`
+	FilterDate string    `json:"filter_date"`
+	Found      int       `json:"found"`
+	Appended   int       `json:"appended"`
+	Errors     int       `json:"errors"`
+	// As reported by the Sheets API.
+	UpdatedRange string `json:"updated_range,omitempty"`
+	UpdatedRows  int64  `json:"updated_rows"`
+	UpdatedCells int64  `json:"updated_cells,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Build an audit entry from the results of a run.
+func newAuditEntry(property, filterDate string, emails, recorded []*EmailMessage, written writeResult, runErr error) auditEntry {
+	entry := auditEntry{
+		Timestamp:    time.Now(),
+		Version:      version,
+		Property:     property,
+		FilterDate:   filterDate,
+		Found:        len(emails),
+		Appended:     len(recorded),
+		UpdatedRange: written.UpdatedRange,
+		UpdatedRows:  written.UpdatedRows,
+		UpdatedCells: written.UpdatedCells,
+	}
+	for _, email := range emails {
+		if email.ZillowSaves < 0 {
+			entry.Errors++
+		}
+	}
+	if runErr != nil {
+		entry.Errors++
+		entry.Error = runErr.Error()
+	}
+	return entry
+}
+
+// Append an entry to the audit log. Failures are logged but not fatal.
+func writeAuditEntry(filename string, entry auditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Printf("Warning: unable to encode audit entry: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Printf("Warning: unable to open audit log: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		fmt.Printf("Warning: unable to write audit log: %v\n", err)
+	}
+}
+
+// Read all entries from the audit log, skipping lines that cannot be parsed.
+func readAuditEntries(filename string) ([]auditEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			fmt.Printf("Warning: skipping unparseable audit log line %d: %v\n", lineNum, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Print a table of the last n runs in the audit log (all runs if n <= 0).
+func listAuditRuns(filename string, n int) error {
+	if filename == "" {
+		return fmt.Errorf("no audit_log configured")
+	}
+	entries, err := readAuditEntries(filename)
+	if err != nil {
+		return fmt.Errorf("unable to read audit log: %v", err)
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+
+	fmt.Printf("%-19s  %-10s  %5s  %8s  %6s  %s\n", "Timestamp", "Filter", "Found", "Appended", "Errors", "Property")
+	for _, entry := range entries {
+		fmt.Printf("%-19s  %-10s  %5d  %8d  %6d  %s\n",
+			entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.FilterDate,
+			entry.Found, entry.Appended, entry.Errors, entry.Property)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Obtain the Google token ahead of time, for machines where a run can't
+// prompt for the authorization code, such as under cron or in a container.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// How long to wait for the browser to be redirected back with the code.
+const authRedirectTimeout = 5 * time.Minute
+
+// Obtain a Google token and save it to the configured token file. The
+// authorization code is taken from code if given; with listen, from a
+// redirect to a local HTTP server on that address; otherwise it is read from
+// standard input, as on a first run.
+func authorizeGoogle(config *Config, code, listen string) error {
+	oauthConfig, err := googleOAuthConfig(config.GoogleCredentialsFile)
+	if err != nil {
+		return err
+	}
+
+	var tok *oauth2.Token
+	switch {
+	case code != "":
+		tok, err = oauthConfig.Exchange(context.Background(), code)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve token: %v", err)
+		}
+	case listen != "":
+		tok, err = tokenFromRedirect(oauthConfig, listen)
+		if err != nil {
+			return err
+		}
+	default:
+		tok, err = getTokenFromWeb(oauthConfig)
+		if err != nil {
+			return err
+		}
+	}
+	return saveToken(googleTokenFile(config.GoogleTokenFile), tok)
+}
+
+// Serve the OAuth redirect on a local address, print the consent URL, and
+// exchange the code the browser is redirected back with for a token. The
+// redirect URL http://<listen>/ must be allowed for the OAuth client.
+func tokenFromRedirect(oauthConfig *oauth2.Config, listen string) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %v", listen, err)
+	}
+	defer listener.Close()
+
+	redirected := *oauthConfig
+	redirected.RedirectURL = "http://" + listen + "/"
+	const state = "state-token"
+
+	codes := make(chan string, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != state || r.URL.Query().Get("code") == "" {
+			http.Error(w, "missing or mismatched authorization code", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "Authorized; you can close this window.")
+		select {
+		case codes <- r.URL.Query().Get("code"):
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Printf("Go to this URL to authorize access:\n%v\n", redirected.AuthCodeURL(state, oauth2.AccessTypeOffline))
+	fmt.Printf("Waiting for the redirect to %s...\n", redirected.RedirectURL)
+	select {
+	case code := <-codes:
+		tok, err := redirected.Exchange(context.Background(), code)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve token: %v", err)
+		}
+		return tok, nil
+	case <-time.After(authRedirectTimeout):
+		return nil, fmt.Errorf("no redirect received within %v", authRedirectTimeout)
+	}
+}
@@ -0,0 +1,208 @@
+// Backfill a long historical range in chunks, checkpointing after each chunk
+// so that an interrupted backfill can be resumed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultBackfillCheckpointFile = "zillowsaves-backfill.json"
+
+// backfillCheckpoint records the progress of a backfill.
+type backfillCheckpoint struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Chunk string `json:"chunk"`
+	// All chunks before this date have been processed.
+	CompletedThrough string `json:"completed_through"`
+}
+
+// Return a function giving the start of the chunk after the one starting at
+// t, for a chunk size of "monthly", "weekly", or a number of days.
+func chunkStepper(chunk string) (func(t time.Time) time.Time, error) {
+	switch chunk {
+	case "monthly":
+		return func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, nil
+	case "weekly":
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }, nil
+	}
+	days, err := strconv.Atoi(chunk)
+	if err != nil || days <= 0 {
+		return nil, fmt.Errorf("invalid chunk %q: expected monthly, weekly, or a number of days", chunk)
+	}
+	return func(t time.Time) time.Time { return t.AddDate(0, 0, days) }, nil
+}
+
+func backfillCheckpointFilename(config *Config) string {
+	if config.BackfillCheckpointFile != "" {
+		return config.BackfillCheckpointFile
+	}
+	return defaultBackfillCheckpointFile
+}
+
+// Load the checkpoint file, returning nil if there is none.
+func loadBackfillCheckpoint(filename string) (*backfillCheckpoint, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint backfillCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", filename, err)
+	}
+	return &checkpoint, nil
+}
+
+func saveBackfillCheckpoint(filename string, checkpoint *backfillCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// Process the emails dated from through to (inclusive), one chunk at a time.
+// Unless restart is set, a checkpoint left by an interrupted backfill of the
+// same range is used to skip the chunks already processed.
+func runBackfill(config *Config, opts runOptions, from, to time.Time, chunk string, restart bool) error {
+	next, err := chunkStepper(chunk)
+	if err != nil {
+		return err
+	}
+	end := to.AddDate(0, 0, 1)
+	if !from.Before(end) {
+		return fmt.Errorf("backfill start %s is after end %s", from.Format(dateFormat), to.Format(dateFormat))
+	}
+
+	checkpointFile := backfillCheckpointFilename(config)
+	checkpoint := &backfillCheckpoint{
+		From:  from.Format(dateFormat),
+		To:    to.Format(dateFormat),
+		Chunk: chunk,
+	}
+	start := from
+	if !restart {
+		saved, err := loadBackfillCheckpoint(checkpointFile)
+		if err != nil {
+			return fmt.Errorf("unable to load backfill checkpoint: %v", err)
+		}
+		if saved != nil && saved.From == checkpoint.From && saved.To == checkpoint.To && saved.Chunk == checkpoint.Chunk {
+			if resumeAt, err := time.Parse(dateFormat, saved.CompletedThrough); err == nil {
+				start = resumeAt
+				fmt.Printf("Resuming backfill from %s, per %s\n", saved.CompletedThrough, checkpointFile)
+			}
+		}
+	}
+
+	// Count the chunks, for progress reporting.
+	total := 0
+	for t := from; t.Before(end); t = next(t) {
+		total++
+	}
+	done := 0
+	for t := from; t.Before(start); t = next(t) {
+		done++
+	}
+
+	var runs backfillRuns
+	for chunkStart := start; chunkStart.Before(end); chunkStart = next(chunkStart) {
+		chunkEnd := next(chunkStart)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		done++
+		fmt.Printf("\n=== Backfill chunk %d of %d: %s through %s ===\n", done, total,
+			chunkStart.Format(dateFormat), chunkEnd.AddDate(0, 0, -1).Format(dateFormat))
+
+		chunkOpts := opts
+		chunkOpts.Since = chunkStart
+		chunkOpts.Before = chunkEnd
+		chunkOpts.DeferReports = true
+		var totals runTotals
+		err := runBackfillChunk(config, chunkOpts, &totals)
+		runs.add(totals.Runs)
+		if err != nil {
+			return runs.report(fmt.Errorf("backfill chunk starting %s failed: %v\nRun the same backfill again to resume from this chunk",
+				chunkStart.Format(dateFormat), err))
+		}
+		// The chunk's other rows were written, but it isn't complete until
+		// every email in it is; rows already in the sheet aren't written again.
+		if totals.ExtractionFailed > 0 {
+			return runs.report(fmt.Errorf("backfill chunk starting %s: data could not be extracted from %d emails\n"+
+				"Fix the patterns (see -save-failures) or use -force, then run the same backfill again to resume from this chunk",
+				chunkStart.Format(dateFormat), totals.ExtractionFailed))
+		}
+
+		checkpoint.CompletedThrough = chunkEnd.Format(dateFormat)
+		if err := saveBackfillCheckpoint(checkpointFile, checkpoint); err != nil {
+			return runs.report(fmt.Errorf("unable to save backfill checkpoint: %v", err))
+		}
+	}
+
+	if err := os.Remove(checkpointFile); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: unable to remove %s: %v\n", checkpointFile, err)
+	}
+	fmt.Printf("Backfill complete: %s through %s\n", from.Format(dateFormat), to.Format(dateFormat))
+	return runs.report(nil)
+}
+
+// Process one backfill chunk within the configured timeout. The sheet is
+// connected for each chunk, since the Google client lasts only as long as
+// the context it was made with.
+func runBackfillChunk(config *Config, opts runOptions, totals *runTotals) error {
+	ctx, cancel := config.runContext()
+	defer cancel()
+	srv, err := connectOutput(ctx, config)
+	if err == nil {
+		err = doProperties(ctx, srv, config, opts, totals)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out (timeout_seconds): %v", err)
+	}
+	return err
+}
+
+// Each property's runs over a backfill, merged, so that its digest, post-run
+// command, and audit entry are sent once for the whole backfill rather than
+// for each chunk.
+type backfillRuns struct {
+	order []string
+	runs  map[string]*propertyRun
+}
+
+func (b *backfillRuns) add(runs []propertyRun) {
+	if b.runs == nil {
+		b.runs = make(map[string]*propertyRun)
+	}
+	for _, run := range runs {
+		name := run.Config.PropertyName
+		if merged, ok := b.runs[name]; ok {
+			merged.merge(run)
+			continue
+		}
+		run := run
+		b.runs[name] = &run
+		b.order = append(b.order, name)
+	}
+}
+
+// Report each property's backfill, as failed if err is set, and return err.
+func (b *backfillRuns) report(err error) error {
+	for _, name := range b.order {
+		run := *b.runs[name]
+		if run.Err == nil {
+			run.Err = err
+		}
+		reportPropertyRun(run)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackfillReportsOnce(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "audit.jsonl")
+	config := &Config{AuditLog: auditLog}
+	first, second := &EmailMessage{ZillowSaves: 12}, &EmailMessage{ZillowSaves: 14}
+
+	var runs backfillRuns
+	runs.add([]propertyRun{{Config: config, FilterDate: "2025-05-01",
+		Emails: []*EmailMessage{first}, Recorded: []*EmailMessage{first},
+		Written: writeResult{UpdatedRange: "Sheet1!A2:D2", UpdatedRows: 1}}})
+	runs.add([]propertyRun{{Config: config, FilterDate: "2025-06-01",
+		Emails: []*EmailMessage{second, {ZillowSaves: -1}}, Recorded: []*EmailMessage{second},
+		Written: writeResult{UpdatedRange: "Sheet1!A3:D3", UpdatedRows: 1}}})
+	failed := errors.New("chunk failed")
+	if err := runs.report(failed); err != failed {
+		t.Errorf("report returned %v, want %v", err, failed)
+	}
+
+	entries, err := readAuditEntries(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1 for the whole backfill", len(entries))
+	}
+	entry := entries[0]
+	if entry.FilterDate != "2025-05-01" || entry.Found != 3 || entry.Appended != 2 || entry.UpdatedRows != 2 {
+		t.Errorf("audit entry = %+v, want filter date 2025-05-01, 3 found, 2 appended and 2 rows updated", entry)
+	}
+	if entry.UpdatedRange != "Sheet1!A2:D2, Sheet1!A3:D3" {
+		t.Errorf("updated range = %q, want both chunks' ranges", entry.UpdatedRange)
+	}
+	if entry.Error != failed.Error() {
+		t.Errorf("audit error = %q, want %q", entry.Error, failed)
+	}
+}
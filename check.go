@@ -0,0 +1,164 @@
+// Check, without fetching or writing anything, that a run would be able to
+// read the config, reach the spreadsheet, and log in to IMAP.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Print the outcome of one check, and return whether it passed.
+func reportCheck(step string, err error) bool {
+	if err != nil {
+		fmt.Printf("FAIL  %s: %v\n", step, err)
+		return false
+	}
+	fmt.Printf("OK    %s\n", step)
+	return true
+}
+
+// Run each check in turn, printing OK or FAIL for each, and return whether
+// all of them passed. Later checks that depend on a failed one are skipped.
+func runChecks(ctx context.Context, config *Config) bool {
+	if !reportCheck("config", validateConfig(config)) {
+		return false
+	}
+	ok := true
+	if config.xlsxOutput() {
+		ok = reportCheck("workbook "+config.XLSXPath, checkWorkbook(config)) && ok
+	} else {
+		ok = checkSheets(ctx, config) && ok
+	}
+	ok = checkIMAP(ctx, config) && ok
+	if ok {
+		fmt.Println("All checks passed")
+	}
+	return ok
+}
+
+// Check that the workbook, if it exists yet, can be read.
+func checkWorkbook(config *Config) error {
+	if _, err := os.Stat(config.XLSXPath); os.IsNotExist(err) {
+		return nil // Created on the first run.
+	}
+	if err := checkXLSXNotOpen(config.XLSXPath); err != nil {
+		return err
+	}
+	_, err := getXLSXData(config.XLSXPath, config.xlsxSheet())
+	return err
+}
+
+// Check the Google credentials and token, and read the first row of each
+// property's range, to prove the spreadsheet can be read.
+func checkSheets(ctx context.Context, config *Config) bool {
+	// Unlike a run, don't prompt for authorization if there is no token.
+	tokFile := googleTokenFile(config.GoogleTokenFile)
+	if _, err := tokenFromFile(tokFile); err != nil {
+		return reportCheck("Google token", fmt.Errorf("unable to read %s (run \"zillowsaves auth\" to create it): %v", tokFile, err))
+	}
+	httpClient, err := getGoogleClient(ctx, config.GoogleCredentialsFile, config.GoogleTokenFile)
+	if !reportCheck("Google credentials", err) {
+		return false
+	}
+	srv, err := sheets.NewService(ctx, option.WithHTTPClient(httpClient))
+	if !reportCheck("Google Sheets client", err) {
+		return false
+	}
+
+	ok := true
+	for _, c := range propertyConfigs(config) {
+		step := "spreadsheet " + c.SpreadsheetID
+		if c.PropertyName != "" {
+			step += " for " + c.PropertyName
+		}
+		readRange := c.Range
+		var err error
+		if c.SheetName != "" {
+			readRange, err = resolveSheetRange(ctx, srv, c.sheetsRetry(), c.SpreadsheetID, c.SheetName)
+		}
+		if err == nil {
+			err = withSheetsRetry(ctx, c.sheetsRetry(), "read", func() error {
+				_, err := srv.Spreadsheets.Values.Get(c.SpreadsheetID, firstRowRange(readRange)).Context(ctx).Do()
+				return err
+			})
+		}
+		ok = reportCheck(step, err) && ok
+	}
+	return ok
+}
+
+// Return the first row of an A1 range, such as Sheet1!A1:D1 for Sheet1!A:D.
+func firstRowRange(a1Range string) string {
+	sheetName, startColumn, startRow := splitA1Range(a1Range)
+	cells := fmt.Sprintf("%s%d", columnLetter(startColumn), startRow)
+	end := a1Range[strings.LastIndex(a1Range, "!")+1:]
+	if i := strings.Index(end, ":"); i >= 0 {
+		if m := a1StartRegex.FindStringSubmatch(end[i+1:]); m != nil {
+			cells += fmt.Sprintf(":%s%d", strings.ToUpper(m[1]), startRow)
+		}
+	}
+	if sheetName != "" {
+		cells = sheetName + "!" + cells
+	}
+	return cells
+}
+
+// Log in to each IMAP account and select each mailbox searched, read-only.
+func checkIMAP(ctx context.Context, config *Config) bool {
+	ok := true
+	for _, account := range accountConfigs(config) {
+		ok = checkIMAPAccount(ctx, config, account) && ok
+	}
+	return ok
+}
+
+// Log in to one IMAP account and select the mailboxes searched in it.
+func checkIMAPAccount(ctx context.Context, config, account *Config) bool {
+	where := ""
+	if account.AccountName != "" {
+		where = " for " + account.AccountName
+	}
+	// As for Google, don't prompt for authorization if there is no token.
+	if account.IMAPOAuthCredentialsFile != "" && usesOAuth2(account.imapAuthMethods()) {
+		tokFile := imapOAuthTokenFile(account.imapProvider(), account.IMAPOAuthTokenFile)
+		if _, err := tokenFromFile(tokFile); err != nil {
+			return reportCheck("IMAP token"+where, fmt.Errorf("not authorized: unable to read %s (run \"zillowsaves fetch\" interactively to authorize): %v", tokFile, err))
+		}
+	}
+	auth, timeouts, retry, err := imapSettings(ctx, account)
+	if !reportCheck("IMAP credentials"+where, err) {
+		return false
+	}
+	c, err := zillow.DialIMAP(ctx, account.imapAddr(), auth, timeouts, retry)
+	if !reportCheck("IMAP login to "+account.imapAddr()+where, err) {
+		return false
+	}
+	defer zillow.LogoutIMAP(c)
+
+	ok := true
+	seen := make(map[string]bool)
+	for _, p := range propertyConfigs(config) {
+		// As in a run, the account's mailboxes override the property's.
+		for _, a := range accountConfigs(p) {
+			if a.AccountName != account.AccountName {
+				continue
+			}
+			for _, mailbox := range a.searchMailboxes() {
+				if seen[mailbox] {
+					continue
+				}
+				seen[mailbox] = true
+				c.Timeout = timeouts.Search
+				_, err := c.Select(mailbox, true)
+				ok = reportCheck("mailbox "+mailbox+where, err) && ok
+			}
+		}
+	}
+	return ok
+}
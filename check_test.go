@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestFirstRowRange(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Sheet1!A:D", "Sheet1!A1:D1"},
+		{"Sheet1!B2:E", "Sheet1!B2:E2"},
+		{"'Saves: 2025'!A1:H100", "'Saves: 2025'!A1:H1"},
+		{"A:D", "A1:D1"},
+	}
+	for _, tt := range tests {
+		if got := firstRowRange(tt.in); got != tt.want {
+			t.Errorf("firstRowRange(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Write each metric to a designated spreadsheet column, instead of appending
+// whole rows positionally.
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Names of the metrics we record, in the order they are appended by default.
+var metricNames = []string{"date", "saves", "contacts", "price_per_sqft"}
+
+// Metrics recorded only when configured, after those in metricNames.
+var optionalMetricNames = []string{"shares", "address", "received_date", "subject"}
+
+// Return the metrics recorded for each email, in the order they are appended:
+// metricNames, then shares, address, received date and subject if enabled or
+// given a column.
+func (c *Config) recordedMetrics() []string {
+	names := metricNames
+	if c.RecordShares || c.Columns["shares"] != "" {
+		names = append(append([]string{}, names...), "shares")
+	}
+	if c.RecordAddress || c.Columns["address"] != "" {
+		names = append(append([]string{}, names...), "address")
+	}
+	if c.RecordReceivedDate || c.Columns["received_date"] != "" {
+		names = append(append([]string{}, names...), "received_date")
+	}
+	if c.RecordSubject || c.Columns["subject"] != "" {
+		names = append(append([]string{}, names...), "subject")
+	}
+	return names
+}
+
+// Return the values recorded for an email, keyed by metric name.
+func emailMetrics(config *Config, email *EmailMessage) map[string]interface{} {
+	var saves interface{} = email.ZillowSaves
+	if email.NoData {
+		saves = config.NoDataPlaceholder
+	}
+	receivedDate := ""
+	if !email.ReceivedDate.IsZero() {
+		receivedDate = email.ReceivedDate.Format("2006-01-02 15:04:05")
+	}
+	return map[string]interface{}{
+		"date":           email.Date.Format(config.sheetDateFormat()),
+		"saves":          saves,
+		"contacts":       email.Contacts,
+		"price_per_sqft": email.PricePerSqFt,
+		"shares":         email.Shares,
+		"address":        email.Address,
+		"received_date":  receivedDate,
+		"subject":        email.Subject,
+	}
+}
+
+// A column letter, or a 1-based column number.
+var columnRegex = regexp.MustCompile(`^([A-Z]+|[1-9]\d*)$`)
+
+// Check that each configured column names a known metric and a valid column.
+func validateColumns(columns map[string]string) error {
+	allNames := append(append([]string{}, metricNames...), optionalMetricNames...)
+	for metric, column := range columns {
+		known := false
+		for _, name := range allNames {
+			if metric == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown metric %q in columns (expected one of %s)", metric, strings.Join(allNames, ", "))
+		}
+		if !columnRegex.MatchString(strings.ToUpper(column)) {
+			return fmt.Errorf("invalid column %q for metric %q", column, metric)
+		}
+	}
+	return nil
+}
+
+var a1StartRegex = regexp.MustCompile(`^([A-Za-z]+)(\d*)`)
+
+// Split an A1 range like "Sheet1!B2:Z" into the sheet name, and the 0-based
+// column and 1-based row at which the range starts (column A and row 1 if
+// not specified).
+func splitA1Range(a1Range string) (sheetName string, startColumn, startRow int) {
+	cells := a1Range
+	if i := strings.LastIndex(a1Range, "!"); i >= 0 {
+		sheetName = a1Range[:i]
+		cells = a1Range[i+1:]
+	}
+	startRow = 1
+	if m := a1StartRegex.FindStringSubmatch(cells); m != nil {
+		startColumn = columnNumber(m[1])
+		if n, err := strconv.Atoi(m[2]); err == nil {
+			startRow = n
+		}
+	}
+	return sheetName, startColumn, startRow
+}
+
+// Write each email's metrics to its configured column, in the rows following
+// the existingRows rows already read from the sheet.
+func writeToColumns(ctx context.Context, srv *sheets.Service, config *Config, existingRows int, emails []*EmailMessage) (writeResult, error) {
+	if err := validateColumns(config.Columns); err != nil {
+		return writeResult{}, err
+	}
+	if len(emails) == 0 {
+		fmt.Println("No email data to write to sheet")
+		return writeResult{}, nil
+	}
+
+	sheetName, _, startRow := splitA1Range(config.Range)
+	prefix := ""
+	if sheetName != "" {
+		prefix = sheetName + "!"
+	}
+
+	var data []*sheets.ValueRange
+	for i, email := range emails {
+		rowNum := startRow + existingRows + i
+		metrics := emailMetrics(config, email)
+		for _, name := range config.recordedMetrics() {
+			column, ok := config.Columns[name]
+			if !ok {
+				continue
+			}
+			column = columnLetter(columnNumber(column))
+			if config.isPreservedColumn(columnNumber(column)) {
+				if i == 0 {
+					fmt.Printf("Warning: not writing %s to column %s, which is in preserve_columns\n", name, column)
+				}
+				continue
+			}
+			data = append(data, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s%s%d", prefix, column, rowNum),
+				Values: [][]interface{}{{metrics[name]}},
+			})
+		}
+	}
+
+	req := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: config.valueInputOption(),
+		Data:             data,
+	}
+	var resp *sheets.BatchUpdateValuesResponse
+	err := withSheetsRetry(ctx, config.sheetsRetry(), "update", func() error {
+		var err error
+		resp, err = srv.Spreadsheets.Values.BatchUpdate(config.SpreadsheetID, req).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return writeResult{}, fmt.Errorf("unable to write data to sheet columns: %v", err)
+	}
+
+	result := writeResult{
+		UpdatedRange: fmt.Sprintf("%srows %d-%d", prefix, startRow+existingRows, startRow+existingRows+len(emails)-1),
+		UpdatedRows:  resp.TotalUpdatedRows,
+		UpdatedCells: resp.TotalUpdatedCells,
+	}
+	if result.UpdatedRows != int64(len(emails)) {
+		fmt.Printf("Warning: sent %d rows but Google Sheets reports %d rows updated\n", len(emails), result.UpdatedRows)
+	}
+	fmt.Printf("Successfully wrote %d rows (%d cells) to Google Sheet columns, %s\n",
+		len(emails), result.UpdatedCells, result.UpdatedRange)
+	return result, nil
+}
+
+// Convert a 0-based column number to a column letter ("A", "B", ..., "AA").
+func columnLetter(n int) string {
+	letters := ""
+	for n++; n > 0; n = (n - 1) / 26 {
+		letters = string(rune('A'+(n-1)%26)) + letters
+	}
+	return letters
+}
+
+// Convert a column letter ("A", "B", ..., "AA"), or a 1-based column number
+// ("1" for A), to a 0-based column number.
+func columnNumber(column string) int {
+	if n, err := strconv.Atoi(column); err == nil {
+		return n - 1
+	}
+	n := 0
+	for _, ch := range strings.ToUpper(column) {
+		n = n*26 + int(ch-'A'+1)
+	}
+	return n - 1
+}
+
+// Return the index within rows read from config.Range at which the given
+// metric is stored, or -1 if it is not recorded.
+func metricColumnIndex(config *Config, metric string) int {
+	if len(config.Columns) == 0 {
+		for i, name := range config.recordedMetrics() {
+			if name == metric {
+				return i
+			}
+		}
+		return -1
+	}
+	column, ok := config.Columns[metric]
+	if !ok {
+		return -1
+	}
+	_, startColumn, _ := splitA1Range(config.Range)
+	return columnNumber(column) - startColumn
+}
+
+// Check that each of PreserveColumns is a column, and not one in which a
+// metric is recorded, which would then never be written.
+func (c *Config) validatePreserveColumns() error {
+	_, startColumn, _ := splitA1Range(c.Range)
+	for _, column := range c.PreserveColumns {
+		if !columnRegex.MatchString(strings.ToUpper(column)) {
+			return fmt.Errorf("invalid column %q in preserve_columns", column)
+		}
+		for i, name := range c.recordedMetrics() {
+			metricColumn := startColumn + i
+			if len(c.Columns) > 0 {
+				mapped, ok := c.Columns[name]
+				if !ok {
+					continue
+				}
+				metricColumn = columnNumber(mapped)
+			}
+			if metricColumn == columnNumber(column) {
+				return fmt.Errorf("preserve_columns %q is column %s, where %s is recorded; preserve a column outside the data, or move %s with columns",
+					column, columnLetter(metricColumn), name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Report whether the given 0-based column is listed in PreserveColumns.
+func (c *Config) isPreservedColumn(column int) bool {
+	for _, letter := range c.PreserveColumns {
+		if columnNumber(letter) == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,422 @@
+// Command-line subcommands. Each subcommand has its own flag set; running
+// with only a config file (and no subcommand) does a daily fetch.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command is a subcommand of zillowsaves.
+type command struct {
+	name        string
+	args        string // Positional arguments, for the usage message.
+	description string
+	run         func(fs *flag.FlagSet, args []string)
+}
+
+// The subcommands, in the order listed by "help". Populated in init to
+// allow cmdHelp to refer to the list.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"fetch", "<config.json>", "fetch new Zillow emails and append their data to the sheet (default)", cmdFetch},
+		{"backfill", "<config.json>", "process a historical date range in chunks, resuming if interrupted", cmdBackfill},
+		{"update", "<config.json> <date> <count>", "correct the saves count recorded for a date (YYYY-MM-DD) in the sheet", cmdUpdate},
+		{"auth", "<config.json>", "authorize access to Google Sheets and save the token, e.g. on a headless server", cmdAuth},
+		{"check", "<config.json>", "check the config, Google Sheets access, and IMAP login, without fetching or writing", cmdCheck},
+		{"listruns", "<config.json>", "print a summary of recent runs from the audit log", cmdListRuns},
+		{"extract", "<email.eml>...", "run extraction on saved emails and print the date and saves count found, without IMAP or Google Sheets", cmdExtract},
+		{"version", "", "print version and build information", cmdVersion},
+		{"help", "[command]", "list the commands, or show the flags for one", cmdHelp},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Printf("Usage: zillowsaves %s [flags] %s\n", cmd.name, cmd.args)
+		fmt.Printf("  %s\n", cmd.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Run the subcommand named by the first argument. If the first argument is
+// not a subcommand, run "fetch" with all the arguments, so that the original
+// "zillowsaves config.json" invocation still works.
+func runCommand(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(1)
+	}
+	if name, rest, ok := legacyCommand(args); ok {
+		fmt.Fprintf(os.Stderr, "Note: -%s is deprecated; use \"zillowsaves %s\"\n", name, name)
+		args = append([]string{name}, rest...)
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		cmd = findCommand("fetch")
+	} else {
+		args = args[1:]
+	}
+	cmd.run(newFlagSet(cmd), args)
+}
+
+// Flags that ran a command before there were subcommands, e.g.
+// "zillowsaves -listruns -n 5 config.json", which are now aliases of the
+// subcommands of the same name.
+var legacyCommandFlags = map[string]bool{"version": true, "listruns": true}
+
+// If the arguments, before any subcommand, include a legacy command flag,
+// return its command and the other arguments.
+func legacyCommand(args []string) (name string, rest []string, ok bool) {
+	if len(args) > 0 && findCommand(args[0]) != nil {
+		return "", nil, false
+	}
+	for i, arg := range args {
+		if name := strings.TrimLeft(arg, "-"); legacyCommandFlags[name] && name != arg {
+			rest = append(append([]string{}, args[:i]...), args[i+1:]...)
+			return name, rest, true
+		}
+	}
+	return "", nil, false
+}
+
+func printUsage() {
+	fmt.Println("Usage: zillowsaves <command> [flags] [arguments]")
+	fmt.Println("       zillowsaves <config.json>    (same as \"fetch\")")
+	fmt.Println("\nCommands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Println("\nRun \"zillowsaves help <command>\" for a command's flags.")
+	fmt.Println("\nExample config.json:")
+	fmt.Println(`{
+  "spreadsheet_id": "your-google-sheet-id",
+  "range": "Sheet1!A:Z", 
+  "yahoo_username": "your-email@yahoo.com",
+  "yahoo_app_password": "your-yahoo-app-password"
+}`)
+	fmt.Println("\nIMPORTANT: You need a Yahoo App Password!")
+	fmt.Println("Get one at: https://login.yahoo.com/account/security")
+}
+
+// Parse the flags, then load the config file named by the single remaining argument.
+func parseWithConfig(fs *flag.FlagSet, args []string) *Config {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	config, err := loadConfig(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	return config
+}
+
+// Like parseWithConfig, for commands that fetch emails and record their data,
+// with the config validated.
+func parseWithValidConfig(fs *flag.FlagSet, args []string) *Config {
+	config := parseWithConfig(fs, args)
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	return config
+}
+
+func cmdFetch(fs *flag.FlagSet, args []string) {
+	diff := fs.Bool("diff", false, "show how the sheet would change, without writing to it")
+	dryRun := fs.Bool("dry-run", false, "print the rows that would be written, without writing them")
+	verbose := fs.Bool("verbose", false, "print debugging detail, such as the last rows of the sheet")
+	force := fs.Bool("force", false, "record emails with no saves count using no_data_placeholder, instead of stopping")
+	sinceStr := fs.String("since", "", "fetch emails dated on or after this YYYY-MM-DD, instead of the day after the sheet's latest date")
+	beforeStr := fs.String("before", "", "fetch only emails dated before this YYYY-MM-DD")
+	fillGaps := fs.Bool("fill-gaps", false, "search from the earliest day missing from the sheet, to fill gaps left by failed runs")
+	output := fs.String("output", "", "also print the extracted data in this `format` (json) on standard output, with progress messages moved to standard error")
+	cacheDir := fs.String("cache-dir", "", "cache fetched emails in this `directory`, and read them from it on later runs (overrides cache_dir)")
+	limit := fs.Int("limit", 0, "append at most `N` new emails, oldest first, so a large backlog can be added over several runs")
+	saveFailures := fs.String("save-failures", "", "save each email whose data can't be extracted to this `directory`, named by UID")
+	exportFile := fs.String("export-merged", "", "write the sheet plus new email data, deduplicated and sorted, to this CSV or .json `file`, without writing to the sheet")
+	reverify := fs.Int("reverify", 0, "instead of fetching new emails, re-extract the saves counts of the last `N` dated rows and report any that differ from the sheet")
+	update := fs.Bool("update", false, "with -reverify, correct the counts that differ in the sheet")
+	interval := fs.Duration("interval", 0, "keep running, fetching every `interval` (e.g. 6h) until interrupted, instead of once")
+	config := parseWithValidConfig(fs, args)
+	if *cacheDir != "" {
+		config.CacheDir = *cacheDir
+	}
+	if *update && *reverify <= 0 {
+		log.Fatalf("-update requires -reverify")
+	}
+	if *interval < 0 || (*interval > 0 && (*reverify > 0 || *output != "" || *exportFile != "")) {
+		log.Fatalf("-interval must be positive, and can't be combined with -reverify, -output, or -export-merged")
+	}
+	if *reverify > 0 {
+		runReverify(config, *reverify, *update)
+		return
+	}
+	if *output != "" && *output != "json" {
+		log.Fatalf("Invalid -output format %q (expected json)", *output)
+	}
+	// Keep standard output for the data alone, so that it can be piped.
+	dataOut := os.Stdout
+	if *output != "" {
+		os.Stdout = os.Stderr
+	}
+
+	opts := runOptions{
+		Diff:         *diff,
+		DryRun:       *dryRun,
+		Verbose:      *verbose,
+		ExportMerged: *exportFile,
+		Force:        *force,
+		FillGaps:     *fillGaps,
+		Limit:        *limit,
+		SaveFailures: *saveFailures,
+	}
+	var err error
+	if *sinceStr != "" {
+		if opts.Since, err = time.Parse(dateFormat, *sinceStr); err != nil {
+			log.Fatalf("Invalid -since date %q: %v", *sinceStr, err)
+		}
+	}
+	if *beforeStr != "" {
+		if opts.Before, err = time.Parse(dateFormat, *beforeStr); err != nil {
+			log.Fatalf("Invalid -before date %q: %v", *beforeStr, err)
+		}
+	}
+	if err := openRunLog(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *interval > 0 {
+		runEvery(config, opts, *interval)
+		return
+	}
+	ctx, cancel := config.runContext()
+	defer cancel()
+	totals, err := doZillow(ctx, config, opts)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		log.Fatalf("Zillow processing timed out (timeout_seconds); a server may be unresponsive: %v", err)
+	}
+	if err != nil {
+		exitOnCredentialsError(err)
+		log.Fatalf("Zillow processing failed: %v", err)
+	}
+	if *output == "json" {
+		if err := writeResultsJSON(dataOut, totals.Results); err != nil {
+			log.Fatalf("Failed to write results: %v", err)
+		}
+	}
+	// Previewing modes never append, so only a real run reports its outcome.
+	if !opts.preview() {
+		if status := totals.exitStatus(); status != 0 {
+			fmt.Printf("Exiting with status %d: %d rows appended, %d extraction failures\n",
+				status, totals.Appended, totals.ExtractionFailed)
+			os.Exit(status)
+		}
+	}
+}
+
+// Reverify each property's last n rows, exiting with status 3 if any
+// differ from their emails and weren't corrected.
+func runReverify(config *Config, n int, update bool) {
+	if err := openRunLog(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	ctx, cancel := config.runContext()
+	defer cancel()
+	propConfigs := propertyConfigs(config)
+	total := 0
+	for _, c := range propConfigs {
+		if len(propConfigs) > 1 {
+			fmt.Printf("\n##### Property: %s #####\n", c.PropertyName)
+		}
+		mismatches, err := reverifyProperty(ctx, c, n, update)
+		if err != nil {
+			exitOnCredentialsError(err)
+			log.Fatalf("Reverify failed: %v", err)
+		}
+		total += mismatches
+	}
+	if total > 0 && !update {
+		os.Exit(exitExtractionFailed)
+	}
+}
+
+func cmdBackfill(fs *flag.FlagSet, args []string) {
+	fromStr := fs.String("from", "", "first date to backfill, YYYY-MM-DD (required)")
+	toStr := fs.String("to", time.Now().Format(dateFormat), "last date to backfill, YYYY-MM-DD")
+	chunk := fs.String("chunk", "monthly", "chunk size: monthly, weekly, or a number of days")
+	restart := fs.Bool("restart", false, "ignore any checkpoint from an interrupted backfill")
+	force := fs.Bool("force", false, "record emails with no saves count using no_data_placeholder, instead of stopping")
+	verbose := fs.Bool("verbose", false, "print debugging detail, such as the last rows of the sheet")
+	saveFailures := fs.String("save-failures", "", "save each email whose data can't be extracted to this `directory`, named by UID")
+	config := parseWithValidConfig(fs, args)
+	if err := openRunLog(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	from, err := time.Parse(dateFormat, *fromStr)
+	if err != nil {
+		log.Fatalf("Invalid -from date %q: %v", *fromStr, err)
+	}
+	to, err := time.Parse(dateFormat, *toStr)
+	if err != nil {
+		log.Fatalf("Invalid -to date %q: %v", *toStr, err)
+	}
+	if err := runBackfill(config, runOptions{Force: *force, Verbose: *verbose, SaveFailures: *saveFailures}, from, to, *chunk, *restart); err != nil {
+		exitOnCredentialsError(err)
+		log.Fatalf("Backfill failed: %v", err)
+	}
+}
+
+func cmdUpdate(fs *flag.FlagSet, args []string) {
+	appendMissing := fs.Bool("append", false, "append a row for the date if the sheet has none")
+	property := fs.String("property", "", "`name` of the property to update, when properties are configured")
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	date, err := time.Parse(dateFormat, fs.Arg(1))
+	if err != nil {
+		log.Fatalf("Invalid date %q: %v", fs.Arg(1), err)
+	}
+	count, err := strconv.Atoi(fs.Arg(2))
+	if err != nil || count < 0 {
+		log.Fatalf("Invalid saves count %q", fs.Arg(2))
+	}
+	config, err := loadConfig(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	propConfig, err := selectProperty(config, *property)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := openRunLog(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	ctx, cancel := config.runContext()
+	defer cancel()
+	if err := updateSavesCount(ctx, propConfig, date, count, *appendMissing); err != nil {
+		exitOnCredentialsError(err)
+		log.Fatalf("Update failed: %v", err)
+	}
+}
+
+func cmdAuth(fs *flag.FlagSet, args []string) {
+	code := fs.String("code", "", "authorization `code` from the consent page, instead of prompting for it")
+	listen := fs.String("listen", "", "receive the authorization code on a local redirect at this `address`, e.g. localhost:8085")
+	config := parseWithConfig(fs, args)
+
+	if err := authorizeGoogle(config, *code, *listen); err != nil {
+		exitOnCredentialsError(err)
+		log.Fatalf("Authorization failed: %v", err)
+	}
+}
+
+func cmdCheck(fs *flag.FlagSet, args []string) {
+	config := parseWithConfig(fs, args)
+
+	ctx, cancel := config.runContext()
+	defer cancel()
+	if !runChecks(ctx, config) {
+		os.Exit(1)
+	}
+}
+
+func cmdListRuns(fs *flag.FlagSet, args []string) {
+	numRuns := fs.Int("n", 10, "number of recent runs to show (0 for all)")
+	config := parseWithConfig(fs, args)
+
+	if err := listAuditRuns(config.AuditLog, *numRuns); err != nil {
+		log.Fatalf("Failed to list runs: %v", err)
+	}
+}
+
+func cmdExtract(fs *flag.FlagSet, args []string) {
+	configFile := fs.String("config", "", "use the saves patterns, report formats, and other extraction settings of this config `file`")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	config := &Config{}
+	if *configFile != "" {
+		var err error
+		if config, err = loadConfig(*configFile); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if err := validateConfig(config); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	loc, err := config.location()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	failed := 0
+	for _, filename := range fs.Args() {
+		email, err := loadEmailFile(filename)
+		if err == nil {
+			if loc != nil {
+				email.Date = email.Date.In(loc)
+			}
+			fmt.Printf("%s:\n", filename)
+			err = extractEmailData(config, email, runOptions{Verbose: true})
+		}
+		if err != nil {
+			fmt.Printf("%s: extraction failed: %v\n\n", filename, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: date %s, saves %d\n\n", filename, email.Date.Format(dateFormat), email.ZillowSaves)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdVersion(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	fmt.Println(versionString())
+}
+
+func cmdHelp(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		printUsage()
+		return
+	}
+	cmd := findCommand(fs.Arg(0))
+	if cmd == nil {
+		fmt.Printf("Unknown command %q\n\n", fs.Arg(0))
+		printUsage()
+		os.Exit(1)
+	}
+	// Let the command register its flags, then print them via -h.
+	cmd.run(newFlagSet(cmd), []string{"-h"})
+}
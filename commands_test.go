@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The flags that ran commands before subcommands still run them.
+func TestLegacyCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		name string
+		rest []string
+		ok   bool
+	}{
+		{[]string{"-version"}, "version", []string{}, true},
+		{[]string{"--version"}, "version", []string{}, true},
+		{[]string{"-listruns", "config.json"}, "listruns", []string{"config.json"}, true},
+		{[]string{"-n", "5", "-listruns", "config.json"}, "listruns", []string{"-n", "5", "config.json"}, true},
+		{[]string{"config.json"}, "", nil, false},
+		{[]string{"-dry-run", "config.json"}, "", nil, false},
+		// A subcommand's own arguments are left alone.
+		{[]string{"fetch", "-version", "config.json"}, "", nil, false},
+		{[]string{"version"}, "", nil, false},
+	}
+	for _, tt := range tests {
+		name, rest, ok := legacyCommand(tt.args)
+		if name != tt.name || ok != tt.ok || (ok && !reflect.DeepEqual(rest, tt.rest)) {
+			t.Errorf("legacyCommand(%q) = %q, %q, %v; want %q, %q, %v", tt.args, name, rest, ok, tt.name, tt.rest, tt.ok)
+		}
+		if ok && findCommand(name) == nil {
+			t.Errorf("legacyCommand(%q) returned unknown command %q", tt.args, name)
+		}
+	}
+}
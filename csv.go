@@ -0,0 +1,101 @@
+// Optional local CSV copy of the recorded rows, kept in addition to the
+// sheet for offline analysis.
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Read the rows of a CSV file, header included; a missing file has none.
+func readCSVRows(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// Append the rows for the emails to csv_file, creating it with a header row
+// if it doesn't exist. As for the sheet, emails whose dates are already in
+// the file are skipped. Columns are in the order rows are appended to the
+// sheet by default, whatever the columns setting.
+func appendToCSV(config *Config, emails []*EmailMessage) error {
+	path := config.CSVFile
+	existing, err := readCSVRows(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	names := config.recordedMetrics()
+	dateIndex := 0
+	dates := make(map[string]bool)
+	for i, row := range existing {
+		if i == 0 {
+			// Find the date column from the header, in case the file was
+			// started with different metrics.
+			for j, heading := range row {
+				if heading == xlsxHeadings["date"] {
+					dateIndex = j
+				}
+			}
+			continue
+		}
+		if dateIndex >= len(row) {
+			continue
+		}
+		if date, err := parseSheetDate(strings.TrimSpace(row[dateIndex]), config.sheetDateFormat()); err == nil {
+			dates[date.Format(dateFormat)] = true
+		}
+	}
+
+	var records [][]string
+	for _, email := range emails {
+		date := email.Date.Format(dateFormat)
+		if dates[date] {
+			fmt.Printf("Email %s for %s: date is already in %s; skipping.\n", email.ID, date, path)
+			continue
+		}
+		dates[date] = true
+		metrics := emailMetrics(config, email)
+		record := make([]string, len(names))
+		for i, name := range names {
+			record[i] = fmt.Sprintf("%v", metrics[name])
+		}
+		records = append(records, record)
+	}
+	appended := len(records)
+	if appended == 0 {
+		return nil
+	}
+	if len(existing) == 0 {
+		var header []string
+		for _, name := range names {
+			header = append(header, xlsxHeadings[name])
+		}
+		records = append([][]string{header}, records...)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Appended %d rows to %s\n", appended, path)
+	return nil
+}
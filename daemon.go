@@ -0,0 +1,52 @@
+// Run repeatedly on an interval, as a long-running service, instead of once
+// per invocation from cron.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Run doZillow now and then every interval until SIGINT or SIGTERM. A failed
+// cycle is reported and the next one runs as usual; only a credentials
+// problem, which needs the user, ends the loop. A signal during a cycle
+// cancels it.
+func runEvery(config *Config, opts runOptions, interval time.Duration) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Running every %v; interrupt to stop\n", interval)
+	for cycle := 1; ; cycle++ {
+		fmt.Printf("\n=== Cycle %d at %s ===\n", cycle, time.Now().Format("2006-01-02 15:04:05"))
+		logEvent("cycle_started", "cycle", cycle)
+		ctx, cancel := config.runContext()
+		unlink := context.AfterFunc(sigCtx, cancel)
+		totals, err := doZillow(ctx, config, opts)
+		unlink()
+		cancel()
+		switch {
+		case sigCtx.Err() != nil:
+			fmt.Printf("Cycle %d interrupted\n", cycle)
+		case err != nil:
+			exitOnCredentialsError(err)
+			fmt.Printf("Cycle %d failed: %v\n", cycle, err)
+			logEvent("cycle_failed", "cycle", cycle, "error", err)
+		default:
+			logEvent("cycle_done", "cycle", cycle, "appended", totals.Appended)
+		}
+
+		select {
+		case <-sigCtx.Done():
+			fmt.Println("Stopping")
+			logEvent("stopped", "cycles", cycle)
+			return
+		case <-ticker.C:
+		}
+	}
+}
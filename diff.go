@@ -0,0 +1,61 @@
+// Compare extracted email data with the current sheet contents, for -diff mode.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Print which dates are new, which already match the sheet, and which
+// conflict with a different value already recorded in the sheet.
+func printSheetDiff(config *Config, rows [][]interface{}, emails []*EmailMessage) {
+	dateIndex := metricColumnIndex(config, "date")
+	savesIndex := metricColumnIndex(config, "saves")
+
+	// Map each date in the sheet to the saves value recorded for it.
+	sheetSaves := make(map[string]string)
+	for _, row := range rows {
+		if dateIndex < 0 || dateIndex >= len(row) {
+			continue
+		}
+		date, err := parseSheetDate(strings.TrimSpace(fmt.Sprintf("%v", row[dateIndex])), config.sheetDateFormat())
+		if err != nil {
+			continue
+		}
+		saves := ""
+		if savesIndex >= 0 && savesIndex < len(row) {
+			saves = strings.TrimSpace(fmt.Sprintf("%v", row[savesIndex]))
+		}
+		sheetSaves[date.Format(dateFormat)] = saves
+	}
+
+	var added, unchanged, conflicts []string
+	for _, email := range emails {
+		date := email.Date.Format(dateFormat)
+		newSaves := fmt.Sprintf("%v", emailMetrics(config, email)["saves"])
+		oldSaves, exists := sheetSaves[date]
+		switch {
+		case !exists:
+			added = append(added, fmt.Sprintf("  + %s  %s", date, newSaves))
+		case oldSaves == newSaves:
+			unchanged = append(unchanged, fmt.Sprintf("  = %s  %s", date, newSaves))
+		default:
+			conflicts = append(conflicts, fmt.Sprintf("  ! %s  sheet has %q, email has %q", date, oldSaves, newSaves))
+		}
+	}
+
+	fmt.Println("\n=== Diff against Google Sheet ===")
+	fmt.Printf("New dates (%d):\n", len(added))
+	for _, line := range added {
+		fmt.Println(line)
+	}
+	fmt.Printf("Already recorded with the same value (%d):\n", len(unchanged))
+	for _, line := range unchanged {
+		fmt.Println(line)
+	}
+	fmt.Printf("Conflicts with a different value in the sheet (%d):\n", len(conflicts))
+	for _, line := range conflicts {
+		fmt.Println(line)
+	}
+	fmt.Println("Diff mode: no changes were written to the sheet")
+}
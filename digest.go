@@ -0,0 +1,98 @@
+// Send a short confirmation email via SMTP after each run.
+package main
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSMTPHost = "smtp.mail.yahoo.com"
+	defaultSMTPPort = 587
+)
+
+// Compose the digest message body from the results of a run: the emails
+// found since filterDate, and those whose data was recorded.
+func composeDigest(filterDate string, emails, recorded []*EmailMessage, written writeResult, runErr error) (subject, body string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Found %d email(s) since %s.\r\n", len(emails), filterDate)
+	for _, email := range emails {
+		if email.ZillowSaves < 0 {
+			fmt.Fprintf(&sb, "Extraction failed for email %s (%s, %s).\r\n",
+				email.ID, email.Date.Format(dateFormat), email.Subject)
+		}
+	}
+	switch {
+	case runErr != nil:
+		subject = "ZillowSaves: run failed"
+		fmt.Fprintf(&sb, "The run failed: %v\r\n", runErr)
+	case len(recorded) == 0:
+		subject = "ZillowSaves: no new data"
+		sb.WriteString("No new saves data was recorded.\r\n")
+	default:
+		latest := recorded[len(recorded)-1]
+		if latest.NoData {
+			subject = fmt.Sprintf("ZillowSaves: no data on %s", latest.Date.Format(dateFormat))
+		} else {
+			subject = fmt.Sprintf("ZillowSaves: %d saves on %s", latest.ZillowSaves, latest.Date.Format(dateFormat))
+		}
+		fmt.Fprintf(&sb, "Recorded %d row(s):\r\n", len(recorded))
+		for _, email := range recorded {
+			if email.NoData {
+				fmt.Fprintf(&sb, "  %s  no data\r\n", email.Date.Format(dateFormat))
+			} else {
+				fmt.Fprintf(&sb, "  %s  %d\r\n", email.Date.Format(dateFormat), email.ZillowSaves)
+			}
+		}
+		if written.UpdatedRange != "" {
+			fmt.Fprintf(&sb, "Sheet range updated: %s\r\n", written.UpdatedRange)
+		}
+	}
+	fmt.Fprintf(&sb, "\r\n-- \r\n%s\r\n", versionString())
+	return subject, sb.String()
+}
+
+// Send a digest email summarizing the run. Failures are logged but not fatal,
+// since the sheet has already been updated by this point.
+func sendDigest(config *Config, filterDate string, emails, recorded []*EmailMessage, written writeResult, runErr error) {
+	host := config.SMTPHost
+	if host == "" {
+		host = defaultSMTPHost
+	}
+	port := config.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	username := config.SMTPUsername
+	if username == "" {
+		username = config.YahooUsername
+	}
+	password := config.SMTPPassword
+	if password == "" {
+		password = config.YahooAppPassword
+	}
+	to := config.DigestTo
+	if to == "" {
+		to = username
+	}
+
+	subject, body := composeDigest(filterDate, emails, recorded, written, runErr)
+	if config.PropertyName != "" {
+		subject += " (" + config.PropertyName + ")"
+	}
+	msg := "From: " + username + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"\r\n" + body
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	auth := smtp.PlainAuth("", username, password, host)
+	if err := smtp.SendMail(addr, auth, username, []string{to}, []byte(msg)); err != nil {
+		fmt.Printf("Warning: unable to send digest email: %v\n", err)
+		return
+	}
+	fmt.Printf("Sent digest email to %s\n", to)
+}
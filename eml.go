@@ -0,0 +1,52 @@
+// Read emails saved as .eml files, for testing extraction without IMAP.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Load an email from a .eml file. Content holds the complete raw message,
+// from which zillow.MessageText decodes the text as it does for fetched emails.
+func loadEmailFile(filename string) (*EmailMessage, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", filename, err)
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse date in %s: %v", filename, err)
+	}
+	return &EmailMessage{
+		Subject:      msg.Header.Get("Subject"),
+		Date:         date,
+		ReceivedDate: receivedDate(msg.Header),
+		ID:           filepath.Base(filename),
+		MessageID:    msg.Header.Get("Message-ID"),
+		Content:      string(data),
+	}, nil
+}
+
+// Return the time given in the topmost Received header, which the receiving
+// server added on delivery, or the zero time if there is none.
+func receivedDate(header mail.Header) time.Time {
+	received := header.Get("Received")
+	i := strings.LastIndex(received, ";")
+	if i < 0 {
+		return time.Time{}
+	}
+	date, err := mail.ParseDate(strings.TrimSpace(received[i+1:]))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
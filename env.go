@@ -0,0 +1,79 @@
+// Override config fields from environment variables, so that secrets such
+// as the app password need not be stored in the config file.
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Environment variables named this prefix plus a config field's JSON name in
+// upper case, e.g. ZILLOW_YAHOO_APP_PASSWORD, override that field.
+const envPrefix = "ZILLOW_"
+
+// Return the environment variable for a field with the given JSON name.
+func envName(jsonName string) string {
+	return envPrefix + strings.ToUpper(jsonName)
+}
+
+// Report whether any config field is set in the environment.
+func hasEnvConfig() bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set the top-level config fields of string, number, boolean, and string
+// list (comma-separated) type that are given in the environment.
+func applyEnvConfig(config *Config) error {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		jsonName := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+		name := envName(jsonName)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: not a number", name, value)
+			}
+			field.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: not true or false", name, value)
+			}
+			field.SetBool(b)
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				return fmt.Errorf("%s can only be set in the config file", jsonName)
+			}
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		default:
+			return fmt.Errorf("%s can only be set in the config file", jsonName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Export the merged dataset (sheet rows plus newly extracted emails) to a
+// CSV or JSON file, without writing to the sheet.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Build the merged dataset: one record per date, keyed by metric name,
+// sorted by date. Where the sheet already has a date, its row is kept,
+// including any preserved (hand-maintained) columns, keyed by column letter.
+func mergeDataset(config *Config, rows [][]interface{}, emails []*EmailMessage) []map[string]string {
+	byDate := make(map[string]map[string]string)
+	dateIndex := metricColumnIndex(config, "date")
+	_, startColumn, _ := splitA1Range(config.Range)
+	for _, row := range rows {
+		if dateIndex < 0 || dateIndex >= len(row) {
+			continue
+		}
+		date, err := parseSheetDate(strings.TrimSpace(fmt.Sprintf("%v", row[dateIndex])), config.sheetDateFormat())
+		if err != nil {
+			// Skip headers and other rows without a date.
+			continue
+		}
+		key := date.Format(dateFormat)
+		if _, exists := byDate[key]; exists {
+			continue
+		}
+		record := make(map[string]string)
+		for _, name := range config.recordedMetrics() {
+			if i := metricColumnIndex(config, name); i >= 0 && i < len(row) {
+				record[name] = strings.TrimSpace(fmt.Sprintf("%v", row[i]))
+			}
+		}
+		for _, letter := range config.PreserveColumns {
+			if i := columnNumber(letter) - startColumn; i >= 0 && i < len(row) {
+				record[strings.ToUpper(letter)] = strings.TrimSpace(fmt.Sprintf("%v", row[i]))
+			}
+		}
+		record["date"] = key
+		byDate[key] = record
+	}
+
+	for _, email := range emails {
+		key := email.Date.Format(dateFormat)
+		if _, exists := byDate[key]; exists {
+			continue
+		}
+		record := make(map[string]string)
+		for name, value := range emailMetrics(config, email) {
+			record[name] = fmt.Sprintf("%v", value)
+		}
+		record["date"] = key
+		byDate[key] = record
+	}
+
+	var records []map[string]string
+	for _, record := range byDate {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i]["date"] < records[j]["date"]
+	})
+	return records
+}
+
+// Write the merged dataset to filename, as JSON if it ends in .json and
+// otherwise as CSV.
+func exportMerged(config *Config, rows [][]interface{}, emails []*EmailMessage, filename string) error {
+	records := mergeDataset(config, rows, emails)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %v", filename, err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(records)
+	} else {
+		header := append([]string{}, config.recordedMetrics()...)
+		for _, letter := range config.PreserveColumns {
+			header = append(header, strings.ToUpper(letter))
+		}
+		w := csv.NewWriter(f)
+		w.Write(header)
+		for _, record := range records {
+			line := make([]string, len(header))
+			for i, name := range header {
+				line[i] = record[name]
+			}
+			w.Write(line)
+		}
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %v", filename, err)
+	}
+
+	fmt.Printf("Exported %d merged rows to %s; the sheet was not modified\n", len(records), filename)
+	return nil
+}
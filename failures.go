@@ -0,0 +1,46 @@
+// Save emails whose data could not be extracted, to see exactly what was
+// delivered when Zillow changes its report.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Return the file in dir for a failed email, named by its UID, with its
+// account and mailbox since UIDs are only unique within them.
+func failedEmailPath(dir string, email *EmailMessage) string {
+	name := strings.TrimSuffix(email.ID, ".eml")
+	if email.Mailbox != "" {
+		name = fmt.Sprintf("%s-%d-%d", email.Mailbox, email.UIDValidity, email.UID)
+	}
+	if email.Account != "" {
+		name = email.Account + "-" + name
+	}
+	return filepath.Join(dir, url.PathEscape(name)+".eml")
+}
+
+// Write the content of an email whose extraction failed to dir, and print
+// where. A fetched email holds only its text part and a few headers, so a
+// Date header is added, which lets the golden test load the file as a fixture.
+func saveFailedEmail(dir string, email *EmailMessage) {
+	content := email.Content
+	if email.UID != 0 {
+		content = "Date: " + email.Date.Format(time.RFC1123Z) + "\r\n" + content
+	}
+	path := failedEmailPath(dir, email)
+	err := os.MkdirAll(dir, 0700)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+	}
+	if err != nil {
+		fmt.Printf("  Warning: unable to save email %s: %v\n", email.ID, err)
+		return
+	}
+	fmt.Printf("  Saved the email to %s\n", path)
+}
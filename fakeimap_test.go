@@ -0,0 +1,199 @@
+// Run the golden fixtures through an in-process IMAP server, so that the
+// search criteria, date filtering, and body extraction of a real fetch can
+// be checked without a mail account.
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/riordanmr/zillowsaves/zillow"
+)
+
+// Login of the user of the go-imap memory backend, whose INBOX also holds
+// one unrelated message that the subject search must leave out.
+const (
+	fakeIMAPUsername = "username"
+	fakeIMAPPassword = "password"
+)
+
+// Start an IMAP server on a loopback port holding emails in its INBOX, each
+// received at its Date, and return a client logged in to it. Closing the
+// returned server also ends the client's connection.
+func startFakeIMAP(emails []*EmailMessage) (*server.Server, *client.Client, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.ErrorLog = nopLogger{}
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("failed to connect to fake IMAP server: %v", err)
+	}
+	if err := c.Login(fakeIMAPUsername, fakeIMAPPassword); err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("failed to login to fake IMAP server: %v", err)
+	}
+	for _, email := range emails {
+		if err := c.Append("INBOX", nil, email.Date, strings.NewReader(email.Content)); err != nil {
+			s.Close()
+			return nil, nil, fmt.Errorf("failed to append %s: %v", email.ID, err)
+		}
+	}
+	return s, c, nil
+}
+
+// Silences the fake server's error log, e.g. of the client hanging up.
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+func (nopLogger) Println(v ...interface{})               {}
+
+var dateHeaderRegex = regexp.MustCompile(`(?m)^Date:[^\r\n]*`)
+
+// Load the fixtures into a fake IMAP server, along with a copy of the
+// oldest dated before the search window, fetch them as a run would, and
+// check the rows against the golden file.
+func TestIMAPGolden(t *testing.T) {
+	fixtures, err := loadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldest := fixtures[0]
+	for _, email := range fixtures {
+		if email.Date.Before(oldest.Date) {
+			oldest = email
+		}
+	}
+	// Dated just before local midnight, so that the server's date-only
+	// SEARCH may return it and the exact window must leave it out.
+	since := startOfDayIn(oldest.Date, oldest.Date.Location())
+	stale := *oldest
+	stale.ID = "stale copy of " + oldest.ID
+	stale.Date = since.Add(-time.Hour)
+	stale.Content = dateHeaderRegex.ReplaceAllLiteralString(oldest.Content, "Date: "+stale.Date.Format(time.RFC1123Z))
+
+	s, c, err := startFakeIMAP(append(fixtures, &stale))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer c.Logout()
+
+	emails, err := zillow.FetchEmailsWith(c, zillow.IMAPTimeouts{}, zillow.IMAPSearch{
+		Mailboxes: []string{"INBOX"},
+		Subject:   emailSubject,
+		Since:     since,
+	})
+	if err != nil {
+		t.Fatalf("fetch from fake IMAP server failed: %v", err)
+	}
+	if len(emails) != len(fixtures) {
+		t.Fatalf("fetched %d emails from fake IMAP server, want the %d fixtures", len(emails), len(fixtures))
+	}
+	checkGoldenRows(t, fixtureDir, emails)
+}
+
+// A message filed in both INBOX and Archive is fetched once.
+func TestFetchSkipsMessageInTwoMailboxes(t *testing.T) {
+	email, err := loadEmailFile(filepath.Join(fixtureDir, "2025-08-01-plain.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, c, err := startFakeIMAP([]*EmailMessage{email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer c.Logout()
+	if err := c.Create("Archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Append("Archive", nil, email.Date, strings.NewReader(email.Content)); err != nil {
+		t.Fatal(err)
+	}
+
+	emails, err := zillow.FetchEmailsWith(c, zillow.IMAPTimeouts{}, zillow.IMAPSearch{
+		Mailboxes: []string{"INBOX", "Archive"},
+		Subject:   emailSubject,
+		Since:     startOfDayIn(email.Date, email.Date.Location()),
+	})
+	if err != nil {
+		t.Fatalf("fetch from fake IMAP server failed: %v", err)
+	}
+	if len(emails) != 1 {
+		t.Fatalf("fetched %d emails from INBOX and Archive, want 1", len(emails))
+	}
+	if want := "<20250801071244.4711@mail.zillow.com>"; emails[0].MessageID != want {
+		t.Errorf("fetched Message-Id %q, want %q", emails[0].MessageID, want)
+	}
+}
+
+// Records how a fetch selects mailboxes and which items it fetches.
+type recordingIMAP struct {
+	*client.Client
+	readOnly []bool
+	items    []imap.FetchItem
+}
+
+func (r *recordingIMAP) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	r.readOnly = append(r.readOnly, readOnly)
+	return r.Client.Select(name, readOnly)
+}
+
+func (r *recordingIMAP) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	r.items = append(r.items, items...)
+	return r.Client.UidFetch(seqset, items, ch)
+}
+
+// Fetching selects mailboxes read-only and peeks at the bodies, so that
+// emails aren't marked read until they are recorded (see mark_processed).
+func TestFetchLeavesEmailsUnread(t *testing.T) {
+	fixtures, err := loadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, c, err := startFakeIMAP(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer c.Logout()
+
+	r := &recordingIMAP{Client: c}
+	emails, err := zillow.FetchEmailsWith(r, zillow.IMAPTimeouts{}, zillow.IMAPSearch{
+		Mailboxes: []string{"INBOX"},
+		Subject:   emailSubject,
+		Since:     time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("fetch from fake IMAP server failed: %v", err)
+	}
+	if len(emails) != len(fixtures) {
+		t.Fatalf("fetched %d emails, want the %d fixtures", len(emails), len(fixtures))
+	}
+	for _, readOnly := range r.readOnly {
+		if !readOnly {
+			t.Errorf("a mailbox was selected read-write")
+		}
+	}
+	for _, item := range r.items {
+		if name := string(item); item == imap.FetchRFC822 || strings.HasPrefix(name, "BODY[") {
+			t.Errorf("fetched %s, which marks the email read", name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// An in-memory stand-in for the Google Sheets values API, enough for the
+// reads, appends, and cell writes the program makes, so that writes can be
+// checked without a spreadsheet.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The cells of each spreadsheet, by ID. Sheet names in ranges are ignored,
+// so each spreadsheet has one sheet.
+type fakeSheets struct {
+	mu      sync.Mutex
+	cells   map[string][][]string
+	appends int // Append requests received.
+	// Status with which to answer each append: a 4xx status rejects it, as
+	// for the rate limit, and a 5xx status answers it after it is applied,
+	// as for a write that was made but whose response was lost.
+	appendStatuses []int
+}
+
+// Start a fake Sheets server holding cells, and return a service that talks
+// to it. The server is closed when the test ends.
+func startFakeSheets(t *testing.T, cells map[string][][]string) (*fakeSheets, *sheets.Service) {
+	t.Helper()
+	f := &fakeSheets{cells: cells}
+	if f.cells == nil {
+		f.cells = make(map[string][][]string)
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(server.Close)
+	srv, err := sheets.NewService(context.Background(),
+		option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, srv
+}
+
+// Return the rows of a spreadsheet.
+func (f *fakeSheets) rows(spreadsheetID string) [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cells[spreadsheetID]
+}
+
+// Set the cell at a 0-based row and column, growing the sheet as needed. A
+// nil value, as the program sends for preserved columns, is skipped.
+func (f *fakeSheets) set(spreadsheetID string, row, column int, value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	rows := f.cells[spreadsheetID]
+	for len(rows) <= row {
+		rows = append(rows, nil)
+	}
+	for len(rows[row]) <= column {
+		rows[row] = append(rows[row], "")
+	}
+	rows[row][column] = fmt.Sprintf("%v", value)
+	f.cells[spreadsheetID] = rows
+	return true
+}
+
+// Write values starting at the top-left cell of a1Range, returning the
+// number of cells written.
+func (f *fakeSheets) write(spreadsheetID, a1Range string, values [][]interface{}) int64 {
+	_, startColumn, startRow := splitA1Range(a1Range)
+	var cells int64
+	for i, row := range values {
+		for j, value := range row {
+			if f.set(spreadsheetID, startRow-1+i, startColumn+j, value) {
+				cells++
+			}
+		}
+	}
+	return cells
+}
+
+func (f *fakeSheets) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/")
+	i := strings.Index(path, "/values")
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	id, rest := path[:i], path[i+len("/values"):]
+	var body struct {
+		Values [][]interface{}
+		Data   []struct {
+			Range  string
+			Values [][]interface{}
+		}
+	}
+	if r.Method != http.MethodGet {
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var resp interface{}
+	switch {
+	case r.Method == http.MethodGet:
+		a1Range := strings.TrimPrefix(rest, "/")
+		_, startColumn, startRow := splitA1Range(a1Range)
+		var values [][]string
+		for i, row := range f.cells[id] {
+			if i < startRow-1 {
+				continue
+			}
+			if startColumn < len(row) {
+				values = append(values, row[startColumn:])
+			} else {
+				values = append(values, []string{})
+			}
+		}
+		resp = map[string]interface{}{"range": a1Range, "values": values}
+	case rest == ":batchUpdate":
+		var cells int64
+		for _, data := range body.Data {
+			cells += f.write(id, data.Range, data.Values)
+		}
+		resp = map[string]interface{}{"totalUpdatedRows": len(body.Data), "totalUpdatedCells": cells}
+	case strings.HasSuffix(rest, ":append"):
+		// Like the real API, append after the last row with any data.
+		a1Range := strings.TrimSuffix(strings.TrimPrefix(rest, "/"), ":append")
+		sheetName, startColumn, _ := splitA1Range(a1Range)
+		next := len(f.cells[id])
+		for next > 0 && strings.Join(f.cells[id][next-1], "") == "" {
+			next--
+		}
+		start := fmt.Sprintf("%s!%s%d", sheetName, columnLetter(startColumn), next+1)
+		f.appends++
+		status := http.StatusOK
+		if len(f.appendStatuses) > 0 {
+			status = f.appendStatuses[0]
+			f.appendStatuses = f.appendStatuses[1:]
+		}
+		if status >= 400 && status < 500 {
+			writeFakeError(w, status)
+			return
+		}
+		cells := f.write(id, start, body.Values)
+		if status != http.StatusOK {
+			writeFakeError(w, status)
+			return
+		}
+		resp = map[string]interface{}{"updates": map[string]interface{}{
+			"updatedRange": fmt.Sprintf("%s:%s%d", start, columnLetter(startColumn+len(body.Values[0])-1), next+len(body.Values)),
+			"updatedRows":  len(body.Values),
+			"updatedCells": cells,
+		}}
+	case r.Method == http.MethodPut:
+		a1Range := strings.TrimPrefix(rest, "/")
+		resp = map[string]interface{}{"updatedRange": a1Range, "updatedCells": f.write(id, a1Range, body.Values)}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Answer with a Sheets API error. Retry-After lets a retry go at once.
+func writeFakeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "0")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": "fake error"}}`, status)
+}
@@ -0,0 +1,50 @@
+// Zillow has changed the layout of its report emails over time; the formats
+// themselves are in the zillow package. The format of each email is detected
+// from the built-in formats and any in the config.
+package main
+
+import "github.com/riordanmr/zillowsaves/zillow"
+
+// ReportFormat describes one layout of the Zillow report email; see
+// zillow.ReportFormat.
+type ReportFormat = zillow.ReportFormat
+
+// Return the default format, with the configured saves patterns if any.
+func (c *Config) defaultReportFormat() *ReportFormat {
+	format := zillow.DefaultReportFormat
+	if len(c.SavesPatterns) > 0 {
+		format.SavesPatterns = c.SavesPatterns
+	}
+	return &format
+}
+
+// Determine the format of an email, checking the formats in the config
+// first, then the built-in ones, and falling back to the default format.
+// Pattern lists the returned format leaves empty are filled from the default.
+func detectReportFormat(config *Config, email *EmailMessage) (*ReportFormat, error) {
+	defaultFormat := config.defaultReportFormat()
+	candidates := append(append([]ReportFormat{}, config.ReportFormats...), zillow.BuiltinReportFormats...)
+	for _, candidate := range candidates {
+		if err := candidate.Validate(); err != nil {
+			return nil, err
+		}
+		if !candidate.Matches(email.Text, email.Date) {
+			continue
+		}
+		format := candidate
+		if len(format.SavesPatterns) == 0 {
+			format.SavesPatterns = defaultFormat.SavesPatterns
+		}
+		if len(format.ContactsPatterns) == 0 {
+			format.ContactsPatterns = defaultFormat.ContactsPatterns
+		}
+		if len(format.PricePatterns) == 0 {
+			format.PricePatterns = defaultFormat.PricePatterns
+		}
+		if len(format.SharesPatterns) == 0 {
+			format.SharesPatterns = defaultFormat.SharesPatterns
+		}
+		return &format, nil
+	}
+	return defaultFormat, nil
+}
@@ -0,0 +1,114 @@
+// Detect days in the search window for which no report email was found, and
+// days missing from the sheet's sequence of dates.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Return the days (YYYY-MM-DD, oldest first) from since through the end of
+// the search window on which none of the emails is dated. The window ends
+// the day before `before` if that is set, and at the latest today. Today is
+// only included once graceHours have passed since midnight, since its report
+// may not have arrived yet.
+func missingReportDays(emails []*EmailMessage, since, before, now time.Time, graceHours int) []string {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	last := today
+	if now.Before(today.Add(time.Duration(graceHours) * time.Hour)) {
+		last = today.AddDate(0, 0, -1)
+	}
+	lastDay := last.Format(dateFormat)
+	if !before.IsZero() {
+		if end := before.AddDate(0, 0, -1).Format(dateFormat); end < lastDay {
+			lastDay = end
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, email := range emails {
+		found[email.Date.Format(dateFormat)] = true
+	}
+	var missing []string
+	for d := since; d.Format(dateFormat) <= lastDay; d = d.AddDate(0, 0, 1) {
+		if day := d.Format(dateFormat); !found[day] {
+			missing = append(missing, day)
+		}
+	}
+	return missing
+}
+
+// Warn about days in the search window with no report email.
+func warnMissingReportDays(config *Config, loc *time.Location, emails []*EmailMessage, since, before time.Time) {
+	now := time.Now()
+	if loc != nil {
+		now = now.In(loc)
+	}
+	missing := missingReportDays(emails, since, before, now, config.TodayGracePeriodHours)
+	if len(missing) > 0 {
+		fmt.Printf("Warning: no report email found for %d day(s): %s\n", len(missing), strings.Join(missing, ", "))
+	}
+}
+
+// Return the days (YYYY-MM-DD, oldest first) between the earliest and latest
+// dates in the sheet rows and emails that none of them is dated.
+func sheetDateGaps(config *Config, rows [][]interface{}, emails []*EmailMessage) []string {
+	found := recordedDates(config, rows)
+	for _, email := range emails {
+		found[email.Date.Format(dateFormat)] = true
+	}
+	var first, last string
+	for day := range found {
+		if first == "" || day < first {
+			first = day
+		}
+		if day > last {
+			last = day
+		}
+	}
+	if first == "" {
+		return nil
+	}
+
+	var missing []string
+	start, _ := time.Parse(dateFormat, first)
+	for d := start; d.Format(dateFormat) < last; d = d.AddDate(0, 0, 1) {
+		if day := d.Format(dateFormat); !found[day] {
+			missing = append(missing, day)
+		}
+	}
+	return missing
+}
+
+// Collapse consecutive days (YYYY-MM-DD, oldest first) into ranges, e.g.
+// "2025-08-03 to 2025-08-05".
+func dayRanges(days []string) []string {
+	var ranges []string
+	for i := 0; i < len(days); {
+		j := i
+		for j+1 < len(days) {
+			d, _ := time.Parse(dateFormat, days[j])
+			if d.AddDate(0, 0, 1).Format(dateFormat) != days[j+1] {
+				break
+			}
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, days[i])
+		} else {
+			ranges = append(ranges, days[i]+" to "+days[j])
+		}
+		i = j + 1
+	}
+	return ranges
+}
+
+// Warn about days missing from the dates in the sheet, including the rows
+// just recorded.
+func warnSheetGaps(config *Config, rows [][]interface{}, recorded []*EmailMessage) {
+	missing := sheetDateGaps(config, rows, recorded)
+	if len(missing) > 0 {
+		fmt.Printf("Warning: the sheet has no row for %d day(s): %s\n", len(missing), strings.Join(dayRanges(missing), ", "))
+	}
+}
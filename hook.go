@@ -0,0 +1,35 @@
+// Run a user-supplied command after a successful run.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Run the post-run command through the shell, passing details of the run in
+// environment variables. A failing command is reported but not fatal.
+func runPostRunCommand(command, filterDate string, recorded []*EmailMessage) {
+	latestSaves := ""
+	if len(recorded) > 0 && !recorded[len(recorded)-1].NoData {
+		latestSaves = fmt.Sprintf("%d", recorded[len(recorded)-1].ZillowSaves)
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("ROWS_APPENDED=%d", len(recorded)),
+		"FILTER_DATE="+filterDate,
+		"LATEST_SAVES="+latestSaves,
+		"ZILLOWSAVES_VERSION="+version,
+	)
+
+	fmt.Printf("Running post-run command: %s\n", command)
+	output, err := cmd.CombinedOutput()
+	if out := strings.TrimRight(string(output), "\n"); out != "" {
+		fmt.Printf("Post-run command output:\n%s\n", out)
+	}
+	if err != nil {
+		fmt.Printf("Warning: post-run command failed: %v\n", err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPostRunCommandEnvironment(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env.txt")
+	recorded := []*EmailMessage{{ZillowSaves: 12}, {ZillowSaves: 14}}
+	runPostRunCommand(`echo "$ROWS_APPENDED $FILTER_DATE $LATEST_SAVES $ZILLOWSAVES_VERSION" > `+out, "2025-08-01", recorded)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(data)), "2 2025-08-01 14 "+version; got != want {
+		t.Errorf("post-run command environment = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Configure how to authenticate to the IMAP server.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/oauth2"
+)
+
+// imapOAuthCredentials is the format of imap_oauth_credentials_file, holding
+// the app registered with the mail provider.
+type imapOAuthCredentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURL  string `json:"redirect_url"` // Default: the provider's.
+}
+
+// Return the methods to log in with: AuthMethods, or else AuthMethod alone,
+// or else the provider's default.
+func (c *Config) imapAuthMethods() []string {
+	if len(c.AuthMethods) == 0 && c.AuthMethod != "" {
+		return []string{c.AuthMethod}
+	}
+	if len(c.AuthMethods) == 0 {
+		return c.imapProvider().AuthMethods
+	}
+	return c.AuthMethods
+}
+
+// Return the fields sent with the IMAP ID command, or nil to send none.
+func (c *Config) imapClientID() map[string]string {
+	name, ver := c.IMAPClientName, c.IMAPClientVersion
+	if name == "-" {
+		return nil
+	}
+	if name == "" {
+		name = "zillowsaves"
+	}
+	if ver == "" {
+		ver = version
+	}
+	return map[string]string{
+		"name":        name,
+		"version":     ver,
+		"support-url": "https://github.com/riordanmr/zillowsaves",
+	}
+}
+
+// Return the TLS settings for the IMAP connection, or nil for the defaults.
+func (c *Config) imapTLSConfig() (*tls.Config, error) {
+	if c.IMAPTLSServerName == "" && c.IMAPTLSCAFile == "" && !c.IMAPTLSInsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         c.IMAPTLSServerName,
+		InsecureSkipVerify: c.IMAPTLSInsecureSkipVerify,
+	}
+	if c.IMAPTLSCAFile != "" {
+		pem, err := ioutil.ReadFile(c.IMAPTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read imap_tls_ca_file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in imap_tls_ca_file %s", c.IMAPTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Return the file holding the provider's OAuth token: tokenFile, or by
+// default one named for the provider.
+func imapOAuthTokenFile(provider imapProvider, tokenFile string) string {
+	if tokenFile == "" {
+		return provider.Name + "-token.json"
+	}
+	return tokenFile
+}
+
+// Return a current access token for XOAUTH2 with the provider. As for
+// Google, the token is read from tokenFile, or obtained from the web and
+// saved there the first time; an expired token is refreshed, and the
+// refreshed one saved.
+func imapOAuthToken(ctx context.Context, provider imapProvider, credentialsFile, tokenFile string) (string, error) {
+	b, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %v", credentialsFile, err)
+	}
+	var creds imapOAuthCredentials
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return "", fmt.Errorf("unable to parse %s: %v", credentialsFile, err)
+	}
+	config := &oauth2.Config{
+		ClientID:     creds.ClientID,
+		ClientSecret: creds.ClientSecret,
+		RedirectURL:  creds.RedirectURL,
+		Endpoint:     provider.OAuthEndpoint,
+		Scopes:       provider.OAuthScopes,
+	}
+	if config.RedirectURL == "" {
+		config.RedirectURL = provider.OAuthRedirectURL
+	}
+
+	tokenFile = imapOAuthTokenFile(provider, tokenFile)
+	tok, err := tokenFromFile(tokenFile)
+	if err != nil {
+		if tok, err = getTokenFromWeb(config); err != nil {
+			return "", err
+		}
+		if err := saveToken(tokenFile, tok); err != nil {
+			return "", err
+		}
+	}
+	fresh, err := config.TokenSource(ctx, tok).Token()
+	if err != nil {
+		return "", fmt.Errorf("unable to refresh %s OAuth token: %v", provider.Name, err)
+	}
+	if fresh.AccessToken != tok.AccessToken {
+		if err := saveToken(tokenFile, fresh); err != nil {
+			return "", err
+		}
+	}
+	return fresh.AccessToken, nil
+}
@@ -16,18 +16,20 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"os"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/riordanmr/zillowsaves/zillow"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
@@ -36,53 +38,204 @@ import (
 
 const (
 	dateFormat         = "2006-01-02"
-	emailSubject       = "Your Daily Listing Report: 9121 Blackhawk Rd"
+	emailSubject       = "Your Daily Listing Report: 9121 Blackhawk Rd" // Default for Config.EmailSubject.
 	fallbackFilterDate = "2025-05-21"
+	// Days by which an email's envelope and report dates may differ before we flag it.
+	defaultDateMismatchDays = 1
 )
 
 type Config struct {
-	SpreadsheetID    string `json:"spreadsheet_id"`
-	Range            string `json:"range"`
+	SpreadsheetID string `json:"spreadsheet_id"`
+	Range         string `json:"range"`
+	// Sheet tab to read and append to, in place of Range; the range is
+	// looked up from the spreadsheet's metadata.
+	SheetName        string `json:"sheet_name"`
 	YahooUsername    string `json:"yahoo_username"`
 	YahooAppPassword string `json:"yahoo_app_password"`
-}
+	// Google OAuth client credentials and saved token (default:
+	// google-credentials.json and google-token.json in the current directory).
+	GoogleCredentialsFile string `json:"google_credentials_file"`
+	GoogleTokenFile       string `json:"google_token_file"`
+
+	// Settings that may be overridden for each of Properties.
+	EmailSubject string `json:"email_subject"`
+	SubjectRegex string `json:"subject_regex"` // Matched against subjects instead of EmailSubject.
+	Timezone     string `json:"timezone"`      // IANA name, e.g. "America/Chicago".
+	DateFormat   string `json:"date_format"`   // Go layout for dates written to the sheet.
+	Mailbox      string `json:"mailbox"`
+	// IMAP mailboxes to search, in order (default: Mailbox, or else INBOX).
+	Mailboxes []string `json:"mailboxes"`
+	// Sender of the reports, used to detect a changed subject (default: zillow.com).
+	ExpectedSender string `json:"expected_sender"`
+
+	Properties       []PropertyConfig `json:"properties"`
+	PropertyName     string           `json:"-"` // Set while processing one of Properties.
+	FilterDateWindow int              `json:"filter_date_window"`
+	PendingFile      string           `json:"pending_file"`
+	ListingStartDate string           `json:"listing_start_date"` // YYYY-MM-DD; emails before this are ignored.
+	// Date from which to search while the sheet has no dates; see startDate.
+	StartDate string `json:"start_date"`
+	// Hours after local midnight before a missing report for today is flagged.
+	TodayGracePeriodHours int `json:"today_grace_period_hours"`
+	// Progress of an interrupted backfill (default: zillowsaves-backfill.json).
+	BackfillCheckpointFile string `json:"backfill_checkpoint_file"`
+	// When the envelope and report dates differ by more than DateMismatchDays,
+	// use the "report" date (default) or keep the "envelope" date.
+	DateMismatchDays   int    `json:"date_mismatch_days"`
+	DateMismatchPolicy string `json:"date_mismatch_policy"`
+	// "report" (default) to date every email by its report date when it has
+	// one; "envelope" to use the report date only on a mismatch.
+	DateSource string `json:"date_source"`
+	// Extracted saves counts outside this range are rejected; 0 means no maximum.
+	MinPlausibleSaves int `json:"min_plausible_saves"`
+	MaxPlausibleSaves int `json:"max_plausible_saves"`
+	// Also record the shares count, in the column after price per square foot.
+	RecordShares bool `json:"record_shares"`
+	// Also record the property address, in the column after the other metrics.
+	RecordAddress bool `json:"record_address"`
+	// Directory in which fetched emails are cached, so that reruns only
+	// download emails not already fetched; empty for no cache.
+	CacheDir string `json:"cache_dir"`
+	// File recording the highest IMAP UID recorded from each mailbox; when
+	// set, new emails are those after it, rather than after the sheet's
+	// latest date.
+	UIDStateFile string `json:"uid_state_file"`
+	// After their data is written, flag the emails \Seen, and move them to
+	// ProcessedMailbox if it is set.
+	MarkProcessed    bool   `json:"mark_processed"`
+	ProcessedMailbox string `json:"processed_mailbox"`
+	// Also record when Yahoo received each email, to measure delivery lag.
+	RecordReceivedDate bool `json:"record_received_date"`
+	// Also record the subject of each email, to show which produced a row.
+	RecordSubject bool `json:"record_subject"`
+	// Saves patterns to use in place of the built-in ones, for emails in the
+	// default format and formats without their own.
+	SavesPatterns []string `json:"saves_patterns"`
+	// Email layouts to check before the built-in ones; see formats.go.
+	ReportFormats []ReportFormat `json:"report_formats"`
+	// Which saves figure to record from an email giving several: "total",
+	// "period", or a word to look for; see zillow.ExtractZillowSavesCount.
+	SavesFigure string `json:"saves_figure"`
+	// What to do with an email whose saves patterns matched different
+	// numbers: "record" (default) the first with a warning, or "skip" it.
+	AmbiguousSaves string `json:"ambiguous_saves"`
+	// Written in the saves column, with -force, for an email with no saves count.
+	NoDataPlaceholder string `json:"no_data_placeholder"`
+	// Read back each append and report any cell that differs from what was sent.
+	VerifyWrites   bool   `json:"verify_writes"`
+	AuditLog       string `json:"audit_log"`
+	LogFile        string `json:"log_file"` // Timestamped log of each run's main events.
+	PostRunCommand string `json:"post_run_command"`
+	// Prometheus textfile to which the outcome of each run is written.
+	MetricsFile string `json:"metrics_file"`
+	// Optional column letter for each metric, e.g. {"date": "A", "saves": "C"}.
+	// When set, only these columns are written; others are left untouched.
+	Columns map[string]string `json:"columns"`
+	// Column letters maintained by hand (e.g. notes), which are never written.
+	PreserveColumns []string `json:"preserve_columns"`
+	// "sheets" (default) or "xlsx" to write to a local Excel workbook instead.
+	OutputMode string `json:"output_mode"`
+	XLSXPath   string `json:"xlsx_path"`
+	XLSXSheet  string `json:"xlsx_sheet"` // Worksheet name (default: Sheet1).
+	// Local CSV file to which the recorded rows are also appended.
+	CSVFile string `json:"csv_file"`
 
-type EmailMessage struct {
-	Subject     string
-	Date        time.Time
-	Content     string
-	ID          string
-	ZillowSaves int
+	// Mail provider, "yahoo" (the default), "gmail", or "outlook", which
+	// sets the defaults for the IMAP server, login, and folder names.
+	Provider string `json:"provider"`
+	// IMAP server (default: the provider's), e.g. imap.gmail.com.
+	IMAPHost string `json:"imap_host"`
+	IMAPPort int    `json:"imap_port"`
+	// IMAP authentication methods to try, in order: "app_password" and/or
+	// "oauth2". AuthMethod names a single one.
+	AuthMethods        []string `json:"auth_methods"`
+	AuthMethod         string   `json:"auth_method"`
+	IMAPOAuthTokenFile string   `json:"imap_oauth_token_file"`
+	// OAuth2 client registered with the mail provider, with which the IMAP
+	// token is obtained and refreshed; see imapOAuthToken.
+	IMAPOAuthCredentialsFile string `json:"imap_oauth_credentials_file"`
+	// How the program identifies itself with the IMAP ID command (default:
+	// "zillowsaves" and its version); a name of "-" sends no ID.
+	IMAPClientName    string `json:"imap_client_name"`
+	IMAPClientVersion string `json:"imap_client_version"`
+	// TLS settings for the IMAP connection: the name to verify the server's
+	// certificate against (default: the host), a PEM file of CA certificates
+	// to trust instead of the system's, and, for testing only, no
+	// verification at all.
+	IMAPTLSServerName         string `json:"imap_tls_server_name"`
+	IMAPTLSCAFile             string `json:"imap_tls_ca_file"`
+	IMAPTLSInsecureSkipVerify bool   `json:"imap_tls_insecure_skip_verify"`
+	// Per-operation IMAP timeouts in seconds; 0 means no timeout.
+	IMAPLoginTimeout  int `json:"imap_login_timeout_seconds"`
+	IMAPSearchTimeout int `json:"imap_search_timeout_seconds"`
+	IMAPFetchTimeout  int `json:"imap_fetch_timeout_seconds"`
+	// Retries of a failed IMAP connect and login (default: 3), waiting
+	// IMAPRetryDelay seconds (default: 2) before the first, doubling each time.
+	IMAPRetries    int `json:"imap_retries"`
+	IMAPRetryDelay int `json:"imap_retry_delay_seconds"`
+	// Mail accounts to fetch from, each with its own login and the settings
+	// above as defaults; see accountConfigs. Empty for just the one account.
+	Accounts    []IMAPAccount `json:"accounts"`
+	AccountName string        `json:"-"` // Set while fetching from one of Accounts.
+	// Retries of a Google Sheets request that fails with 429 or a 5xx
+	// error (default: 3), waiting SheetsRetryDelay seconds (default: 2)
+	// before the first, doubling each time, unless Google gives a Retry-After.
+	SheetsRetries    int `json:"sheets_retries"`
+	SheetsRetryDelay int `json:"sheets_retry_delay_seconds"`
+	// How Sheets treats written values: "RAW" (default) stores them as
+	// given; "USER_ENTERED" parses dates and numbers as if typed.
+	ValueInputOption string `json:"value_input_option"`
+	// Limit on a whole run (each chunk, for backfill), in seconds (default:
+	// 120); negative means no limit.
+	TimeoutSeconds int `json:"timeout_seconds"`
+
+	// Optional confirmation email sent after each run.
+	SendDigest   bool   `json:"send_digest"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	DigestTo     string `json:"digest_to"`
 }
 
-// Load the application configuration from a JSON file.
+// EmailMessage is an email fetched by the library; see zillow.Email.
+type EmailMessage = zillow.Email
+
+// Load the application configuration from a JSON file, with any fields set
+// in the environment taking precedence. The file may be missing if the
+// settings are all in the environment.
 func loadConfig(filename string) (*Config, error) {
+	var config Config
 	data, err := ioutil.ReadFile(filename)
-	if err != nil {
+	if err != nil && !(os.IsNotExist(err) && hasEnvConfig()) {
 		return nil, err
 	}
-	var config Config
-	return &config, json.Unmarshal(data, &config)
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, err
+		}
+	}
+	return &config, applyEnvConfig(&config)
 }
 
-// Obtain a Google OAuth2 token from the web, prompting the user to visit a URL.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
+// Obtain an OAuth2 token from the web, prompting the user to visit a URL.
+func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	fmt.Printf("Go to this URL and enter the authorization code: \n%v\n", authURL)
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+		return nil, fmt.Errorf("unable to read authorization code: %v", err)
 	}
 
 	tok, err := config.Exchange(context.TODO(), authCode)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token: %v", err)
+		return nil, fmt.Errorf("unable to retrieve token: %v", err)
 	}
-	return tok
+	return tok, nil
 }
 
-// Obtain a Google OAuth2 token from a local file.
+// Obtain an OAuth2 token from a local file.
 func tokenFromFile(file string) (*oauth2.Token, error) {
 	f, err := os.Open(file)
 	if err != nil {
@@ -93,42 +246,188 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 	return tok, json.NewDecoder(f).Decode(tok)
 }
 
-// Save a Google OAuth2 token to a local file.
-func saveToken(path string, token *oauth2.Token) {
+// Save an OAuth2 token to a local file.
+func saveToken(path string, token *oauth2.Token) error {
 	fmt.Printf("Saving credential file to: %s\n", path)
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		log.Fatalf("Unable to cache token: %v", err)
+		return fmt.Errorf("unable to cache token: %v", err)
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	if err := json.NewEncoder(f).Encode(token); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to cache token: %v", err)
+	}
+	return f.Close()
 }
 
-// Return a Google HTTP client with credentials.
-func getGoogleClient(ctx context.Context) (*http.Client, error) {
-	googleCredsFilename := "google-credentials.json"
+// credentialsError is a missing or unusable Google credentials file, which
+// is reported with setup instructions rather than as a failure.
+type credentialsError struct {
+	msg string
+}
+
+func (e *credentialsError) Error() string {
+	return e.msg
+}
+
+// How to obtain the credentials file, shown when it is missing or malformed.
+const credentialsHelp = `To get one:
+  1. Go to https://console.cloud.google.com/ and create or select a project
+  2. Enable the Google Sheets API
+  3. Under APIs & Services > Credentials, create an OAuth 2.0 Client ID
+     of type "Desktop app"
+  4. Download its JSON file and save it as %s
+     (or set google_credentials_file in the config to its path)`
+
+// Load the Google OAuth2 client configuration from the credentials file.
+func googleOAuthConfig(credentialsFile string) (*oauth2.Config, error) {
+	googleCredsFilename := credentialsFile
+	if googleCredsFilename == "" {
+		googleCredsFilename = "google-credentials.json"
+	}
 	b, err := ioutil.ReadFile(googleCredsFilename)
+	if os.IsNotExist(err) {
+		return nil, &credentialsError{fmt.Sprintf("Google credentials file %s not found.\n"+credentialsHelp,
+			googleCredsFilename, googleCredsFilename)}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to read %s: %v", googleCredsFilename, err)
 	}
 
 	config, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+		return nil, &credentialsError{fmt.Sprintf("Google credentials file %s is not a valid OAuth client file (%v).\n"+credentialsHelp,
+			googleCredsFilename, err, googleCredsFilename)}
 	}
+	return config, nil
+}
 
-	tokFile := "google-token.json"
+// If err is a credentialsError, print it and exit.
+func exitOnCredentialsError(err error) {
+	var credErr *credentialsError
+	if errors.As(err, &credErr) {
+		fmt.Fprintln(os.Stderr, credErr)
+		os.Exit(1)
+	}
+}
+
+// Return the file the Google token is saved in.
+func googleTokenFile(tokenFile string) string {
+	if tokenFile == "" {
+		return "google-token.json"
+	}
+	return tokenFile
+}
+
+// Return a Google HTTP client with credentials.
+func getGoogleClient(ctx context.Context, credentialsFile, tokenFile string) (*http.Client, error) {
+	config, err := googleOAuthConfig(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tokFile := googleTokenFile(tokenFile)
 	tok, err := tokenFromFile(tokFile)
 	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		if tok, err = getTokenFromWeb(config); err != nil {
+			return nil, err
+		}
+		if err := saveToken(tokFile, tok); err != nil {
+			return nil, err
+		}
+	}
+
+	// Refresh the token now rather than on the first Sheets request, so
+	// that a revoked token is reported as such instead of as a Sheets error.
+	source := config.TokenSource(ctx, tok)
+	fresh, err := source.Token()
+	if err != nil {
+		return nil, tokenRefreshError(tokFile, err)
+	}
+	if fresh.AccessToken != tok.AccessToken {
+		logEvent("google_token_refreshed", "expiry", fresh.Expiry.Format(time.RFC3339))
+		if err := saveToken(tokFile, fresh); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(fresh, source)), nil
+}
+
+// Describe a failure to refresh the Google token. If Google rejected the
+// refresh token as expired or revoked, the token file is renamed aside, so
+// that the next interactive run authorizes again, and a credentialsError
+// explains what to do.
+func tokenRefreshError(tokFile string, err error) error {
+	logEvent("google_token_refresh_failed", "error", err)
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) || retrieveErr.ErrorCode != "invalid_grant" {
+		return fmt.Errorf("unable to refresh the Google token in %s: %v", tokFile, err)
+	}
+	stale := tokFile + ".revoked"
+	if renameErr := os.Rename(tokFile, stale); renameErr != nil {
+		return &credentialsError{fmt.Sprintf("The Google token in %s has expired or been revoked (%v), "+
+			"and it could not be moved aside: %v.\nDelete it and run \"zillowsaves auth <config.json>\" to authorize again.",
+			tokFile, retrieveErr.ErrorDescription, renameErr)}
+	}
+	return &credentialsError{fmt.Sprintf("The Google token in %s has expired or been revoked (%s); it was moved to %s.\n"+
+		"Run \"zillowsaves auth <config.json>\" to authorize again.", tokFile, retrieveErr.ErrorDescription, stale)}
+}
+
+// Return the A1 range covering every column of the named sheet tab, looked
+// up in the spreadsheet's metadata, for reading rows and appending them.
+func resolveSheetRange(ctx context.Context, srv *sheets.Service, retry sheetsRetry, spreadsheetID, sheetName string) (string, error) {
+	var spreadsheet *sheets.Spreadsheet
+	err := withSheetsRetry(ctx, retry, "metadata read", func() error {
+		var err error
+		spreadsheet, err = srv.Spreadsheets.Get(spreadsheetID).Fields("sheets.properties").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to read spreadsheet metadata: %v", err)
 	}
-	return config.Client(ctx, tok), nil
+	var titles []string
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties == nil {
+			continue
+		}
+		if sheet.Properties.Title != sheetName {
+			titles = append(titles, sheet.Properties.Title)
+			continue
+		}
+		columns := int64(len(metricNames))
+		if grid := sheet.Properties.GridProperties; grid != nil && grid.ColumnCount > columns {
+			columns = grid.ColumnCount
+		}
+		quoted := "'" + strings.ReplaceAll(sheetName, "'", "''") + "'"
+		return fmt.Sprintf("%s!A1:%s", quoted, columnLetter(int(columns-1))), nil
+	}
+	return "", fmt.Errorf("no sheet named %q in the spreadsheet (sheets: %s)", sheetName, strings.Join(titles, ", "))
+}
+
+// Return the config with Range set to cover the sheet named by SheetName,
+// if set, or else unchanged.
+func withSheetRange(ctx context.Context, srv *sheets.Service, config *Config) (*Config, error) {
+	if config.SheetName == "" || config.xlsxOutput() {
+		return config, nil
+	}
+	sheetRange, err := resolveSheetRange(ctx, srv, config.sheetsRetry(), config.SpreadsheetID, config.SheetName)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Using range %s for sheet %s\n", sheetRange, config.SheetName)
+	resolved := *config
+	resolved.Range = sheetRange
+	return &resolved, nil
 }
 
 // Return all rows from a Google Sheet.
-func getSheetData(srv *sheets.Service, spreadsheetID, readRange string) ([][]interface{}, error) {
-	resp, err := srv.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
+func getSheetData(ctx context.Context, srv *sheets.Service, retry sheetsRetry, spreadsheetID, readRange string) ([][]interface{}, error) {
+	var resp *sheets.ValueRange
+	err := withSheetsRetry(ctx, retry, "read", func() error {
+		var err error
+		resp, err = srv.Spreadsheets.Values.Get(spreadsheetID, readRange).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve data from sheet: %v", err)
 	}
@@ -136,222 +435,1046 @@ func getSheetData(srv *sheets.Service, spreadsheetID, readRange string) ([][]int
 	return resp.Values, nil
 }
 
-// Append Zillow saves data (date and number of saves on that date) to a Google Sheet.
-func appendToSheet(srv *sheets.Service, spreadsheetID, sheetRange string, emails []*EmailMessage) error {
-	// Prepare the data to append
+// Return the rows to be appended to the sheet for the given emails.
+// Cells in preserved columns are left null, which the Sheets API skips.
+func sheetRows(config *Config, emails []*EmailMessage) [][]interface{} {
+	_, startColumn, _ := splitA1Range(config.Range)
 	var values [][]interface{}
 	for _, email := range emails {
-		// Format date as YYYY-MM-DD
-		dateStr := email.Date.Format("2006-01-02")
-
-		// Create row: [Date, Saves Count]
-		row := []interface{}{dateStr, email.ZillowSaves}
+		// Create row: [Date, Saves Count, Contacts, Price/sqft (, Shares)]
+		metrics := emailMetrics(config, email)
+		names := config.recordedMetrics()
+		row := make([]interface{}, len(names))
+		for i, name := range names {
+			if !config.isPreservedColumn(startColumn + i) {
+				row[i] = metrics[name]
+			}
+		}
 		values = append(values, row)
 	}
+	return values
+}
+
+// What the Sheets API reported writing.
+type writeResult struct {
+	UpdatedRange string
+	UpdatedRows  int64
+	UpdatedCells int64
+}
+
+// Maximum rows sent in one append request, to stay within the Sheets API's
+// request size limits when backfilling months of history.
+const appendBatchSize = 500
+
+// Append Zillow saves data (date, number of saves, number of contacts, and
+// price per square foot on that date) to a Google Sheet, in batches of at
+// most appendBatchSize rows. If a batch fails, the error says how many rows
+// were appended before it.
+func appendToSheet(ctx context.Context, srv *sheets.Service, config *Config, emails []*EmailMessage) (writeResult, error) {
+	// Prepare the data to append
+	values := sheetRows(config, emails)
 
 	if len(values) == 0 {
 		fmt.Println("No email data to append to sheet")
-		return nil
+		return writeResult{}, nil
+	}
+
+	var result writeResult
+	var ranges []string
+	for start := 0; start < len(values); start += appendBatchSize {
+		end := start + appendBatchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		batch := values[start:end]
+		if len(values) > appendBatchSize {
+			fmt.Printf("Appending rows %d-%d of %d...\n", start+1, end, len(values))
+		}
+		batchResult, err := appendValues(ctx, srv, config.sheetsRetry(), config.valueInputOption(), config.SpreadsheetID, config.Range, batch)
+		var quotaErr *dailyQuotaError
+		if errors.As(err, &quotaErr) {
+			// Keep every unwritten row, not just this batch's, for the next run.
+			quotaErr.Rows = values[start:]
+		}
+		if err != nil && start > 0 {
+			return result, fmt.Errorf("appended %d of %d rows before failing: %w", start, len(values), err)
+		}
+		if err != nil {
+			return result, err
+		}
+		if config.VerifyWrites {
+			verifyWrite(ctx, srv, config.SpreadsheetID, batchResult.UpdatedRange, batch)
+		}
+		result.UpdatedRows += batchResult.UpdatedRows
+		result.UpdatedCells += batchResult.UpdatedCells
+		ranges = append(ranges, batchResult.UpdatedRange)
+		result.UpdatedRange = strings.Join(ranges, ", ")
 	}
 
+	fmt.Printf("Successfully appended %d rows (%d cells) to Google Sheet range %s\n",
+		len(values), result.UpdatedCells, result.UpdatedRange)
+	return result, nil
+}
+
+// Append rows of values to a Google Sheet, warning if the API reports
+// writing a different number of rows than were sent.
+// If Google reports that the daily write quota is exhausted, the returned
+// error is a *dailyQuotaError carrying the rows that were not written.
+func appendValues(ctx context.Context, srv *sheets.Service, retry sheetsRetry, inputOption, spreadsheetID, sheetRange string, values [][]interface{}) (writeResult, error) {
 	// Create the request body
 	valueRange := &sheets.ValueRange{
 		Values: values,
 	}
 
 	// Append the data to the sheet
-	_, err := srv.Spreadsheets.Values.Append(spreadsheetID, sheetRange, valueRange).
-		ValueInputOption("RAW").
-		InsertDataOption("INSERT_ROWS").
+	var resp *sheets.AppendValuesResponse
+	// A retried append would add its rows again if the first attempt was
+	// written, so it is only retried when Google rejected it unwritten.
+	err := withSheetsRateLimitRetry(ctx, retry, "append", func() error {
+		var err error
+		resp, err = srv.Spreadsheets.Values.Append(spreadsheetID, sheetRange, valueRange).
+			ValueInputOption(inputOption).
+			InsertDataOption("INSERT_ROWS").
+			Context(ctx).
+			Do()
+		return err
+	})
+
+	if err != nil {
+		if isDailyQuotaError(err) {
+			return writeResult{}, &dailyQuotaError{Rows: values, Err: err}
+		}
+		return writeResult{}, fmt.Errorf("unable to append data to sheet: %v", err)
+	}
+
+	var result writeResult
+	if resp.Updates != nil {
+		result.UpdatedRange = resp.Updates.UpdatedRange
+		result.UpdatedRows = resp.Updates.UpdatedRows
+		result.UpdatedCells = resp.Updates.UpdatedCells
+	}
+	if result.UpdatedRows != int64(len(values)) {
+		fmt.Printf("Warning: sent %d rows but Google Sheets reports %d rows updated (range %q)\n",
+			len(values), result.UpdatedRows, result.UpdatedRange)
+	}
+	return result, nil
+}
+
+// Read back the range reported by an append and print any cell that doesn't
+// match what was sent. Null cells (preserved columns) aren't checked.
+func verifyWrite(ctx context.Context, srv *sheets.Service, spreadsheetID, updatedRange string, values [][]interface{}) {
+	if updatedRange == "" {
+		fmt.Println("Warning: cannot verify write: Google Sheets did not report the updated range")
+		return
+	}
+	resp, err := srv.Spreadsheets.Values.Get(spreadsheetID, updatedRange).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		Context(ctx).
 		Do()
+	if err != nil {
+		fmt.Printf("Warning: cannot verify write: unable to read back %s: %v\n", updatedRange, err)
+		return
+	}
 
+	mismatches := 0
+	for i, row := range values {
+		var got []interface{}
+		if i < len(resp.Values) {
+			got = resp.Values[i]
+		}
+		for j, want := range row {
+			if want == nil {
+				continue
+			}
+			gotCell := ""
+			if j < len(got) {
+				gotCell = fmt.Sprintf("%v", got[j])
+			}
+			if wantCell := fmt.Sprintf("%v", want); gotCell != wantCell {
+				fmt.Printf("Warning: write verification failed in %s, row %d, column %d: sent %q, sheet has %q\n",
+					updatedRange, i+1, j+1, wantCell, gotCell)
+				mismatches++
+			}
+		}
+	}
+	if mismatches == 0 {
+		fmt.Printf("Verified %d rows written to %s\n", len(values), updatedRange)
+	}
+}
+
+// Date an email by the report date in its body, if it has one. With
+// date_source "envelope", the envelope date is kept unless the two differ by
+// more than the configured threshold (e.g. a forwarded old email), in which
+// case a warning is printed and, per the configured policy, the report date
+// is used instead.
+func checkReportDate(config *Config, email *EmailMessage) {
+	reportDate, err := zillow.ExtractReportDate(email.Text)
 	if err != nil {
-		return fmt.Errorf("unable to append data to sheet: %v", err)
+		if config.DateSource != "envelope" {
+			fmt.Printf("  No report date in the email; using envelope date %s\n", email.Date.Format(dateFormat))
+		}
+		return
+	}
+	if config.DateSource != "envelope" {
+		useReportDate(email, reportDate)
+		return
+	}
+	threshold := config.DateMismatchDays
+	if threshold <= 0 {
+		threshold = defaultDateMismatchDays
+	}
+	envelopeDay := time.Date(email.Date.Year(), email.Date.Month(), email.Date.Day(), 0, 0, 0, 0, time.UTC)
+	diffDays := int(envelopeDay.Sub(reportDate).Hours() / 24)
+	if diffDays < 0 {
+		diffDays = -diffDays
+	}
+	if diffDays <= threshold {
+		return
 	}
 
-	fmt.Printf("Successfully appended %d rows to Google Sheet\n", len(values))
-	return nil
+	fmt.Printf("  Warning: envelope date %s differs from report date %s by %d days\n",
+		email.Date.Format(dateFormat), reportDate.Format(dateFormat), diffDays)
+	if config.DateMismatchPolicy == "envelope" {
+		fmt.Println("  Keeping envelope date, per date_mismatch_policy")
+		return
+	}
+	useReportDate(email, reportDate)
+}
+
+// Date an email by the day of its report, keeping the time of day.
+func useReportDate(email *EmailMessage, reportDate time.Time) {
+	email.Date = time.Date(reportDate.Year(), reportDate.Month(), reportDate.Day(),
+		email.Date.Hour(), email.Date.Minute(), email.Date.Second(), 0, email.Date.Location())
+	fmt.Printf("  Using report date %s\n", email.Date.Format(dateFormat))
+}
+
+// Parse a date from a sheet cell, trying the layout we write (if other than
+// the default) and then the formats we have seen in the sheet.
+func parseSheetDate(dateStr string, layouts ...string) (time.Time, error) {
+	formats := append(layouts, dateFormat, "1/2/2006", "01/02/2006", "2006/01/02", "Jan 2, 2006")
+	for _, format := range formats {
+		if parsedDate, err := time.Parse(format, dateStr); err == nil {
+			return parsedDate, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date format: %q", dateStr)
 }
 
-// Given an email body, extract the Zillow saves count.
-func extractZillowSavesCount(content string) (int, error) {
-	patterns := []string{
-		`(\d+)\s+saves?`,
-		// `saved\s+(\d+)\s+times?`,
-		// `(\d+)\s+people?\s+saved`,
-		// `total\s+saves?:\s*(\d+)`,
-		// `save\s+count:\s*(\d+)`,
-		// `(\d+)\s+favorites?`,
-		// `favorited\s+(\d+)\s+times?`,
+// Determine the date from which to search for emails: the day after the
+// latest parseable date in column dateIndex of the sheet, or of its last
+// tailWindow rows if tailWindow is positive. We use the latest date rather than the last row's
+// because the sheet sometimes contains duplicate or out-of-order rows, e.g.
+// corrections inserted by hand; a warning is printed if there are any.
+// With no dates to go by, the search starts from fallback.
+func deriveFilterDate(rows [][]interface{}, dateIndex, tailWindow int, layout, fallback string) string {
+	if len(rows) == 0 {
+		fmt.Printf("Warning: No rows found in sheet, using start date: %s\n", fallback)
+		return fallback
 	}
 
-	lowerContent := strings.ToLower(content)
+	start := 0
+	if tailWindow > 0 && tailWindow < len(rows) {
+		start = len(rows) - tailWindow
+	}
+	var latest, previous time.Time
+	latestRow := -1
+	var unparsed, outOfOrder []int
+	for i := start; i < len(rows); i++ {
+		row := rows[i]
+		if dateIndex < 0 || dateIndex >= len(row) || row[dateIndex] == nil {
+			continue
+		}
+		dateStr := strings.TrimSpace(fmt.Sprintf("%v", row[dateIndex]))
+		parsedDate, err := parseSheetDate(dateStr, layout)
+		if err != nil {
+			unparsed = append(unparsed, i+1)
+			continue
+		}
+		if parsedDate.Before(previous) {
+			outOfOrder = append(outOfOrder, i+1)
+		}
+		previous = parsedDate
+		// Use !Before so that among equal dates we report the last such row.
+		if latestRow < 0 || !parsedDate.Before(latest) {
+			latest = parsedDate
+			latestRow = i
+		}
+	}
 
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
-		matches := re.FindStringSubmatch(lowerContent)
-		if len(matches) > 1 {
-			if count, err := strconv.Atoi(matches[1]); err == nil {
-				return count, nil
-			}
+	// A heading in the first row is expected.
+	if len(unparsed) > 0 && !(len(unparsed) == 1 && unparsed[0] == 1) {
+		fmt.Printf("Warning: Could not parse the date in %d row(s), e.g. row %d\n", len(unparsed), unparsed[len(unparsed)-1])
+	}
+	if len(outOfOrder) > 0 {
+		fmt.Printf("Warning: %d row(s) dated before the row above, e.g. row %d; sort the sheet by date to tidy it\n",
+			len(outOfOrder), outOfOrder[0])
+	}
+
+	if latestRow < 0 {
+		fmt.Printf("Warning: No parseable dates in %d rows, using start date: %s\n",
+			len(rows)-start, fallback)
+		return fallback
+	}
+
+	// Add one day to start searching from the day after the latest entry.
+	filterDate := latest.AddDate(0, 0, 1).Format(dateFormat)
+	fmt.Printf("Using filter date from sheet: %s (day after latest entry %s in row %d: %v)\n",
+		filterDate, latest.Format(dateFormat), latestRow+1, rows[latestRow])
+	return filterDate
+}
+
+// Drop emails dated before the listing start date.
+func skipEmailsBefore(emails []*EmailMessage, listingStart time.Time) []*EmailMessage {
+	var kept []*EmailMessage
+	for _, email := range emails {
+		if email.Date.Before(listingStart) {
+			fmt.Printf("Email %s dated %s is before listing start date %s; skipping.\n",
+				email.ID, email.Date.Format(dateFormat), listingStart.Format(dateFormat))
+			continue
 		}
+		kept = append(kept, email)
 	}
+	return kept
+}
+
+// Return a fingerprint of an email's date, subject, and body text, the same
+// for two deliveries of one report even if their Message-Ids differ.
+func emailFingerprint(email *EmailMessage) [sha256.Size]byte {
+	text := email.Text
+	if text == "" {
+		text = zillow.MessageText(email.Content)
+	}
+	return sha256.Sum256([]byte(email.Date.UTC().Format(time.RFC3339) + "\x00" +
+		email.Subject + "\x00" + strings.TrimSpace(text)))
+}
+
+// Drop emails with the same fingerprint as an earlier one in the batch,
+// which Yahoo sometimes delivers twice, keeping the first.
+func dedupeEmails(config *Config, emails []*EmailMessage) []*EmailMessage {
+	var kept []*EmailMessage
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, email := range emails {
+		fp := emailFingerprint(email)
+		if seen[fp] {
+			fmt.Printf("Email %s dated %s is a duplicate of an earlier one; skipping.\n",
+				email.ID, email.Date.Format(dateFormat))
+			continue
+		}
+		seen[fp] = true
+		kept = append(kept, email)
+	}
+	if collapsed := len(emails) - len(kept); collapsed > 0 {
+		fmt.Printf("Collapsed %d duplicate email(s)\n", collapsed)
+		logEvent("duplicates_collapsed", "property", config.PropertyName, "count", collapsed)
+	}
+	return kept
+}
+
+// Return the host:port of the IMAP server, defaulting to Yahoo's.
+func (c *Config) imapAddr() string {
+	host := strings.TrimSpace(c.IMAPHost)
+	if host == "" {
+		host = c.imapProvider().Host
+	}
+	port := c.IMAPPort
+	if port == 0 {
+		port = c.imapProvider().Port
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
 
-	return 0, nil
+// Fetch emails with the given subject (or any subject, if empty) dated on
+// or after since, and before before unless it is zero.
+func getYahooEmails(ctx context.Context, config *Config, subject string, since, before time.Time, lastUIDs map[string]uidState) ([]*EmailMessage, error) {
+	auth, timeouts, retry, err := imapSettings(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	search := zillow.IMAPSearch{
+		Mailboxes:       config.searchMailboxes(),
+		Subject:         subject,
+		Sender:          config.ExpectedSender,
+		Since:           since,
+		Before:          before,
+		CacheDir:        config.CacheDir,
+		LastUIDs:        lastUIDs,
+		SimilarSubjects: similarSubjects(subject),
+	}
+	return zillow.FetchEmails(ctx, config.imapAddr(), auth, timeouts, retry, search)
+}
+
+// Return the credentials, timeouts, and retry policy for connecting to IMAP.
+func imapSettings(ctx context.Context, config *Config) (zillow.IMAPAuth, zillow.IMAPTimeouts, zillow.IMAPRetry, error) {
+	auth := zillow.IMAPAuth{
+		Username:       config.YahooUsername,
+		Password:       config.YahooAppPassword,
+		Methods:        config.imapAuthMethods(),
+		OAuthTokenFile: config.IMAPOAuthTokenFile,
+		ClientID:       config.imapClientID(),
+	}
+	tlsConfig, err := config.imapTLSConfig()
+	if err != nil {
+		return auth, zillow.IMAPTimeouts{}, zillow.IMAPRetry{}, err
+	}
+	auth.TLSConfig = tlsConfig
+	if config.IMAPTLSInsecureSkipVerify {
+		fmt.Println("Warning: imap_tls_insecure_skip_verify is set; the IMAP server's certificate is not verified")
+	}
+	if config.IMAPOAuthCredentialsFile != "" && usesOAuth2(auth.Methods) {
+		provider := config.imapProvider()
+		provider.OAuthScopes = config.imapOAuthScopes()
+		token, err := imapOAuthToken(ctx, provider, config.IMAPOAuthCredentialsFile, config.IMAPOAuthTokenFile)
+		if err != nil {
+			return auth, zillow.IMAPTimeouts{}, zillow.IMAPRetry{}, err
+		}
+		auth.AccessToken = token
+	}
+	timeouts := zillow.IMAPTimeouts{
+		Login:  time.Duration(config.IMAPLoginTimeout) * time.Second,
+		Search: time.Duration(config.IMAPSearchTimeout) * time.Second,
+		Fetch:  time.Duration(config.IMAPFetchTimeout) * time.Second,
+	}
+	retry := zillow.IMAPRetry{
+		Retries:   config.IMAPRetries,
+		BaseDelay: time.Duration(config.IMAPRetryDelay) * time.Second,
+	}
+	if retry.Retries == 0 {
+		retry.Retries = zillow.DefaultIMAPRetries
+	}
+	if retry.BaseDelay == 0 {
+		retry.BaseDelay = zillow.DefaultIMAPRetryDelay
+	}
+	return auth, timeouts, retry, nil
+}
+
+// Check an extracted saves count against the configured plausible range, to
+// catch stray numbers (e.g. a year) being misread as the count.
+func checkPlausibleSaves(config *Config, count int) error {
+	if count < config.MinPlausibleSaves {
+		return fmt.Errorf("%w: %d is below the minimum %d", errImplausibleSaves, count, config.MinPlausibleSaves)
+	}
+	if config.MaxPlausibleSaves > 0 && count > config.MaxPlausibleSaves {
+		return fmt.Errorf("%w: %d is above the maximum %d", errImplausibleSaves, count, config.MaxPlausibleSaves)
+	}
+	return nil
 }
 
-func getYahooEmails(username, appPassword, subject, since string) ([]*EmailMessage, error) {
-	return connectToYahooIMAP(username, appPassword, subject, since)
+// Returned, wrapped, for a saves count outside the plausible range.
+var errImplausibleSaves = errors.New("implausible saves count")
+
+// Returned for an ambiguous saves count when ambiguous_saves is "skip".
+var errAmbiguousSaves = errors.New("saves count is ambiguous")
+
+// Extract the Zillow saves count and other metrics from an email, recording
+// them in the email and printing them. With opts.Force, an email with no
+// saves count is marked NoData instead of failing.
+func extractEmailData(config *Config, email *EmailMessage, opts runOptions) error {
+	fmt.Printf("  Subject: %s\n", email.Subject)
+	fmt.Printf("  Date: %s\n", email.Date.Format("2006-01-02 15:04:05"))
+	if !email.ReceivedDate.IsZero() {
+		fmt.Printf("  Received: %s\n", email.ReceivedDate.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("  ID: %s\n", email.ID)
+	email.Text = zillow.MessageText(email.Content)
+	checkReportDate(config, email)
+	format, err := detectReportFormat(config, email)
+	if err != nil {
+		email.ZillowSaves = -1
+		fmt.Printf("  Format: [Error: %v]\n", err)
+		return err
+	}
+	email.Format = format.Name
+	fmt.Printf("  Format: %s\n", email.Format)
+	match, err := zillow.ExtractZillowSavesMatch(email.Text, format, config.SavesFigure)
+	count := match.Count
+	if err == nil && opts.Verbose {
+		fmt.Printf("  Saves matched %q in: %s\n", match.Pattern, match.Snippet)
+	}
+	if err == nil && match.Ambiguous {
+		fmt.Printf("  Warning: saves count %d (from %q in: %s) is ambiguous; other patterns matched:\n",
+			count, match.Pattern, match.Snippet)
+		for _, other := range match.Conflicts {
+			fmt.Printf("    %d (from %q in: %s)\n", other.Count, other.Pattern, other.Snippet)
+		}
+		logEvent("ambiguous_saves", "property", config.PropertyName, "email", email.ID,
+			"saves", count, "pattern", match.Pattern, "conflicts", len(match.Conflicts))
+		if config.AmbiguousSaves == "skip" {
+			err = errAmbiguousSaves
+		}
+	}
+	switch {
+	case err == zillow.ErrNoSavesCount && opts.Force:
+		email.NoData = true
+		fmt.Printf("  Zillow Saves: [not found in email; recording %q]\n", config.NoDataPlaceholder)
+	case err != nil:
+		email.ZillowSaves = -1 // Indicate error with -1
+		fmt.Printf("  Zillow Saves: [Error: %v]\n", err)
+		if err == zillow.ErrNoSavesCount {
+			fmt.Println("  Rerun with -force to record it using no_data_placeholder")
+		}
+		return err
+	default:
+		if err := checkPlausibleSaves(config, count); err != nil {
+			email.ZillowSaves = -1
+			fmt.Printf("  Zillow Saves: [Rejected %d from email %s (%s): %v]\n", count, email.ID, email.Subject, err)
+			return err
+		}
+		email.ZillowSaves = count
+		fmt.Printf("  Saves Count: %d\n", email.ZillowSaves)
+	}
+
+	if contacts, found := zillow.ExtractContactsCount(email.Text, format); found {
+		email.Contacts = contacts
+		fmt.Printf("  Contacts: %d\n", email.Contacts)
+	} else {
+		fmt.Println("  Contacts: [not found in email; recording 0]")
+	}
+
+	if price, found := zillow.ExtractPricePerSqFt(email.Text, format); found {
+		email.PricePerSqFt = price
+		fmt.Printf("  Price/sqft: $%d\n", email.PricePerSqFt)
+	} else {
+		fmt.Println("  Price/sqft: [not found in email; recording 0]")
+	}
+
+	// Fall back to the raw message, whose subject header names the property.
+	address, err := zillow.ExtractPropertyAddress(email.Text)
+	if err != nil {
+		address, err = zillow.ExtractPropertyAddress(email.Content)
+	}
+	if err == nil {
+		email.Address = address
+		fmt.Printf("  Address: %s\n", email.Address)
+	} else if config.RecordAddress {
+		fmt.Println("  Address: [not found in email; recording blank]")
+	}
+
+	// Reports often omit shares, so only mention them when they're recorded.
+	if shares, found := zillow.ExtractSharesCount(email.Text, format); found {
+		email.Shares = shares
+		fmt.Printf("  Shares: %d\n", email.Shares)
+	} else if config.RecordShares {
+		fmt.Println("  Shares: [not found in email; recording 0]")
+	}
+	return nil
 }
 
 // Process the accumulated emails, extracting the Zillow saves counts and
 // appending them to the Google Sheet.
-func processData(srv *sheets.Service, config *Config, rows [][]interface{}, emails []*EmailMessage) {
+// Returns the emails whose data was recorded in the sheet, and what the
+// Sheets API reported writing.
+func processData(ctx context.Context, srv *sheets.Service, config *Config, opts runOptions, rows [][]interface{}, emails []*EmailMessage) ([]*EmailMessage, writeResult, error) {
 	// Some debug output.
-	fmt.Println("\n=== Google Sheets Data ===")
-	if len(rows) <= 4 {
-		// If 4 or fewer rows, print all
-		for i, row := range rows {
-			fmt.Printf("Row %d: %v\n", i+1, row)
-		}
-	} else {
-		fmt.Printf("Retrieved %d rows from Google Sheet; will show last 4:\n", len(rows))
+	if opts.Verbose {
+		fmt.Println("\n=== Google Sheets Data ===")
+		if len(rows) <= 4 {
+			// If 4 or fewer rows, print all
+			for i, row := range rows {
+				fmt.Printf("Row %d: %v\n", i+1, row)
+			}
+		} else {
+			fmt.Printf("Retrieved %d rows from Google Sheet; will show last 4:\n", len(rows))
 
-		// Print last 4 rows
-		for i := len(rows) - 4; i < len(rows); i++ {
-			fmt.Printf("Row %d: %v\n", i+1, rows[i])
+			// Print last 4 rows
+			for i := len(rows) - 4; i < len(rows); i++ {
+				fmt.Printf("Row %d: %v\n", i+1, rows[i])
+			}
 		}
 	}
 
 	bOK := true
+	var extracted []*EmailMessage
 	fmt.Println("\n=== Yahoo Mail Data ===")
 	for i, email := range emails {
 		fmt.Printf("Email %d:\n", i+1)
-		fmt.Printf("  Subject: %s\n", email.Subject)
-		fmt.Printf("  Date: %s\n", email.Date.Format("2006-01-02 15:04:05"))
-		fmt.Printf("  ID: %s\n", email.ID)
-		count, err := extractZillowSavesCount(email.Content)
-		if err == nil {
-			email.ZillowSaves = count
-		} else {
+		err := extractEmailData(config, email, opts)
+		if err != nil && opts.SaveFailures != "" {
+			saveFailedEmail(opts.SaveFailures, email)
+		}
+		if err == zillow.ErrNoSavesCount || err == errAmbiguousSaves || errors.Is(err, errImplausibleSaves) {
+			// Unlike a genuine "0 saves", no count at all is not data, and
+			// neither is one that can't be trusted.
+			logEvent("extraction_failed", "property", config.PropertyName, "email", email.ID, "error", err)
+			fmt.Printf("  Skipping email %s: %v\n\n", email.ID, err)
+			continue
+		}
+		if err != nil {
+			logEvent("extraction_failed", "property", config.PropertyName, "email", email.ID, "error", err)
 			bOK = false
-			email.ZillowSaves = -1 // Indicate error with -1
-			fmt.Printf("  Zillow Saves: [Error: %v]\n", err)
 			break
 		}
-		fmt.Printf("  Saves Count: %d\n", email.ZillowSaves)
-
+		email.Extracted = true
+		extracted = append(extracted, email)
+		logEvent("extracted", "property", config.PropertyName, "email", email.ID,
+			"date", email.Date.Format(dateFormat), "saves", emailMetrics(config, email)["saves"],
+			"contacts", email.Contacts, "price_per_sqft", email.PricePerSqFt)
 		fmt.Println()
 	}
 
-	if bOK {
-		appendToSheet(srv, config.SpreadsheetID, config.Range, emails)
+	if !bOK {
+		return nil, writeResult{}, nil
+	}
+	emails = extracted
+	if opts.Diff {
+		printSheetDiff(config, rows, emails)
+		return nil, writeResult{}, nil
+	}
+	if opts.ExportMerged != "" {
+		return nil, writeResult{}, exportMerged(config, rows, emails, opts.ExportMerged)
+	}
+	emails = skipRecordedDates(config, rows, emails)
+	if opts.Limit > 0 && len(emails) > opts.Limit {
+		fmt.Printf("Appending the oldest %d of %d new emails (-limit); rerun for the rest\n", opts.Limit, len(emails))
+		emails = emails[:opts.Limit]
+	}
+	if opts.DryRun {
+		values := sheetRows(config, emails)
+		fmt.Printf("\n=== Dry run: %d rows would be written ===\n", len(values))
+		for _, row := range values {
+			fmt.Printf("%v\n", row)
+		}
+		return nil, writeResult{}, nil
+	}
+	var result writeResult
+	var err error
+	if config.xlsxOutput() {
+		result, err = appendToXLSX(config, emails)
+	} else if len(config.Columns) > 0 {
+		result, err = writeToColumns(ctx, srv, config, len(rows), emails)
+	} else {
+		result, err = appendToSheet(ctx, srv, config, emails)
+		err = handleDailyQuotaError(config, err)
+	}
+	if err != nil {
+		return nil, result, err
+	}
+	logEvent("rows_written", "property", config.PropertyName, "rows", result.UpdatedRows,
+		"cells", result.UpdatedCells, "range", result.UpdatedRange)
+	if config.CSVFile != "" {
+		// The CSV file is only a copy, so it doesn't fail the run.
+		if err := appendToCSV(config, emails); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	return emails, result, nil
+}
+
+// Return the dates (YYYY-MM-DD) already recorded in the sheet rows, in any
+// of the date layouts parseSheetDate accepts.
+func recordedDates(config *Config, rows [][]interface{}) map[string]bool {
+	dates := make(map[string]bool)
+	dateIndex := metricColumnIndex(config, "date")
+	for _, row := range rows {
+		if dateIndex < 0 || dateIndex >= len(row) {
+			continue
+		}
+		date, err := parseSheetDate(strings.TrimSpace(fmt.Sprintf("%v", row[dateIndex])), config.sheetDateFormat())
+		if err != nil {
+			continue
+		}
+		dates[date.Format(dateFormat)] = true
 	}
+	return dates
 }
 
-// Main function to execute the Zillow saves processing.
-func doZillow(config *Config) error {
-	googleCtx := context.Background()
+// Drop emails whose dates are already in the sheet, or that share a date
+// with an earlier email in the batch, so no date is appended twice.
+func skipRecordedDates(config *Config, rows [][]interface{}, emails []*EmailMessage) []*EmailMessage {
+	dates := recordedDates(config, rows)
+	keptFor := make(map[string]string) // Date to the kept email's ID.
+	var kept []*EmailMessage
+	for _, email := range emails {
+		date := email.Date.Format(dateFormat)
+		if id, ok := keptFor[date]; ok {
+			fmt.Printf("Email %s for %s: date is already recorded from email %s; skipping.\n", email.ID, date, id)
+			continue
+		}
+		if dates[date] {
+			fmt.Printf("Email %s for %s: date is already in the sheet; skipping.\n", email.ID, date)
+			continue
+		}
+		keptFor[date] = email.ID
+		kept = append(kept, email)
+	}
+	return kept
+}
 
-	// Connect to Google Sheets and download the data.
+// Options for a run, set from the command line.
+type runOptions struct {
+	Diff         bool   // Print what would change in the sheet, without writing.
+	DryRun       bool   // Print the rows that would be written, without writing.
+	Verbose      bool   // Print debugging detail, such as the last sheet rows.
+	ExportMerged string // Write the merged dataset to this file, without writing to the sheet.
+	Force        bool   // Record emails with no saves count using the no-data placeholder.
+	FillGaps     bool   // Search from the earliest day missing from the sheet.
+	Limit        int    // Append at most this many emails, oldest first; 0 for no limit.
+	SaveFailures string // Save emails whose extraction fails to this directory.
+	DeferReports bool   // Leave each property's digest, post-run command, and audit entry to the caller.
+	// Search window; a zero Since means derive it from the sheet, and a zero
+	// Before means no upper bound.
+	Since  time.Time
+	Before time.Time
+}
+
+// Report whether the run only previews its data, writing nothing to the
+// sheet, so that it shouldn't be reported or acted on as a real run.
+func (o runOptions) preview() bool {
+	return o.Diff || o.DryRun || o.ExportMerged != ""
+}
+
+// Connect to Google Sheets.
+func newSheetsService(ctx context.Context, config *Config) (*sheets.Service, error) {
 	fmt.Println("Accessing Google Sheets...")
-	httpClient, err := getGoogleClient(googleCtx)
+	httpClient, err := getGoogleClient(ctx, config.GoogleCredentialsFile, config.GoogleTokenFile)
+	if err != nil {
+		// Keep a credentialsError intact for exitOnCredentialsError.
+		return nil, fmt.Errorf("unable to create Google client: %w", err)
+	}
+	srv, err := sheets.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
-		log.Fatalf("Unable to create Google client: %v", err)
+		return nil, fmt.Errorf("unable to retrieve Sheets client: %v", err)
+	}
+	return srv, nil
+}
+
+// Exit statuses, besides 0 for success and 1 for a failed run, that let a
+// cron wrapper notice when reports have stopped being found or parsed.
+const (
+	exitNoNewData        = 2 // Nothing was appended.
+	exitExtractionFailed = 3 // Extraction failed for at least one email.
+)
+
+// Counts accumulated over the properties processed in a run.
+type runTotals struct {
+	Fetched          int
+	Extracted        int
+	Appended         int
+	Duplicates       int // Extracted, but the date was already in the sheet.
+	ExtractionFailed int
+	PropertyFailed   int
+	Results          []emailResult // Each email whose data was extracted.
+	Ranges           []string      // Where rows were written, as reported.
+	Runs             []propertyRun // Each property's run, when its reports are deferred.
+}
+
+// Add the results for one property, whose sheet held rows before the run.
+func (t *runTotals) add(config *Config, rows [][]interface{}, emails, recorded []*EmailMessage) {
+	t.Fetched += len(emails)
+	t.Appended += len(recorded)
+	isRecorded := make(map[*EmailMessage]bool)
+	for _, email := range recorded {
+		isRecorded[email] = true
+	}
+	dates := recordedDates(config, rows)
+	for _, email := range emails {
+		if email.ZillowSaves < 0 {
+			t.ExtractionFailed++
+		}
+		if email.Extracted {
+			t.Extracted++
+			if dates[email.Date.Format(dateFormat)] {
+				t.Duplicates++
+			}
+			t.Results = append(t.Results, newEmailResult(config, email, isRecorded[email]))
+		}
+	}
+}
+
+// Return the one-line summary printed at the end of a run.
+func (t *runTotals) summary() string {
+	return fmt.Sprintf("Run complete: fetched %d emails, extracted %d counts, appended %d rows, skipped %d duplicates, %d errors",
+		t.Fetched, t.Extracted, t.Appended, t.Duplicates, t.ExtractionFailed+t.PropertyFailed)
+}
+
+// Return the exit status for a run that didn't fail outright.
+func (t *runTotals) exitStatus() int {
+	switch {
+	case t.ExtractionFailed > 0:
+		return exitExtractionFailed
+	case t.Appended == 0:
+		return exitNoNewData
+	}
+	return 0
+}
+
+const defaultRunTimeout = 120 * time.Second
+
+// Return a context that expires after the configured overall run timeout.
+func (c *Config) runContext() (context.Context, context.CancelFunc) {
+	timeout := time.Duration(c.TimeoutSeconds) * time.Second
+	switch {
+	case c.TimeoutSeconds < 0:
+		return context.WithCancel(context.Background())
+	case timeout == 0:
+		timeout = defaultRunTimeout
 	}
-	srv, err := sheets.NewService(googleCtx, option.WithHTTPClient(httpClient))
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// Main function to execute the Zillow saves processing.
+func doZillow(ctx context.Context, config *Config, opts runOptions) (runTotals, error) {
+	var totals runTotals
+	srv, err := connectOutput(ctx, config)
+	if err == nil {
+		err = doProperties(ctx, srv, config, opts, &totals)
+		fmt.Println(totals.summary())
+		if len(totals.Ranges) > 0 {
+			fmt.Printf("Rows written to: %s\n", strings.Join(totals.Ranges, ", "))
+		}
+	}
+	if config.MetricsFile != "" && !opts.preview() {
+		if metricsErr := writeMetricsFile(config.MetricsFile, totals, err); metricsErr != nil {
+			fmt.Printf("Warning: %v\n", metricsErr)
+		}
+	}
+	return totals, err
+}
+
+// Connect to Google Sheets and write any pending rows. Returns a nil service
+// when writing to an Excel workbook instead.
+func connectOutput(ctx context.Context, config *Config) (*sheets.Service, error) {
+	if config.xlsxOutput() {
+		return nil, nil
+	}
+	srv, err := newSheetsService(ctx, config)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve Sheets client: %v", err)
+		return nil, err
 	}
 
-	rows, err := getSheetData(srv, config.SpreadsheetID, config.Range)
+	// Write any rows left over from a run that hit the daily quota, before
+	// reading the sheet so that the filter date accounts for them.
+	if err := flushPendingRows(ctx, srv, config); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// Process each property; a failure for one doesn't stop the others.
+func doProperties(ctx context.Context, srv *sheets.Service, config *Config, opts runOptions, totals *runTotals) error {
+	propConfigs := propertyConfigs(config)
+	if len(propConfigs) == 1 {
+		err := doProperty(ctx, srv, propConfigs[0], opts, totals)
+		if err != nil {
+			logEvent("error", "error", err)
+			totals.PropertyFailed++
+		}
+		return err
+	}
+	var failed []string
+	for _, propConfig := range propConfigs {
+		fmt.Printf("\n##### Property: %s #####\n", propConfig.PropertyName)
+		if err := doProperty(ctx, srv, propConfig, opts, totals); err != nil {
+			logEvent("error", "property", propConfig.PropertyName, "error", err)
+			fmt.Printf("Error processing property %s: %v\n", propConfig.PropertyName, err)
+			failed = append(failed, propConfig.PropertyName)
+			totals.PropertyFailed++
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("processing failed for properties: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Fetch the emails for one property and append their data to its sheet
+// range, adding the results to totals.
+func doProperty(ctx context.Context, srv *sheets.Service, config *Config, opts runOptions, totals *runTotals) error {
+	loc, err := config.location()
 	if err != nil {
-		log.Fatalf("Failed to get sheet data: %v", err)
+		return err
+	}
+	subjectRe, err := config.subjectRegex()
+	if err != nil {
+		return err
 	}
-	fmt.Printf("Retrieved %d rows from Google Sheet\n", len(rows))
 
-	// Determine filterDate from last row in sheet.
-	var dynamicFilterDate string
-	if len(rows) > 0 {
-		lastRow := rows[len(rows)-1]
-		if len(lastRow) > 0 && lastRow[0] != nil {
-			// Get the date from the first column of the last row
-			dateStr := strings.TrimSpace(fmt.Sprintf("%v", lastRow[0]))
-
-			// Parse and validate the date
-			if parsedDate, err := time.Parse("2006-01-02", dateStr); err == nil {
-				// Add one day to start searching from the day after the last entry
-				nextDay := parsedDate.AddDate(0, 0, 1)
-				dynamicFilterDate = nextDay.Format("2006-01-02")
-				fmt.Printf("Using filter date from sheet: %s (day after last entry: %s)\n", dynamicFilterDate, dateStr)
-			} else {
-				// Try alternative date formats if the standard format fails
-				formats := []string{"1/2/2006", "01/02/2006", "2006/01/02", "Jan 2, 2006"}
-				parsed := false
-				for _, format := range formats {
-					if parsedDate, err := time.Parse(format, dateStr); err == nil {
-						nextDay := parsedDate.AddDate(0, 0, 1)
-						dynamicFilterDate = nextDay.Format("2006-01-02")
-						fmt.Printf("Using filter date from sheet: %s (parsed from %s, day after last entry)\n", dynamicFilterDate, dateStr)
-						parsed = true
-						break
-					}
-				}
-				if !parsed {
-					fmt.Printf("Warning: Could not parse date '%s' from last row, using default filter date: %s\n", dateStr, fallbackFilterDate)
-					dynamicFilterDate = fallbackFilterDate
-				}
-			}
-		} else {
-			fmt.Printf("Warning: Last row has no data in first column, using default filter date: %s\n", fallbackFilterDate)
-			dynamicFilterDate = fallbackFilterDate
+	if config, err = withSheetRange(ctx, srv, config); err != nil {
+		return err
+	}
+
+	var rows [][]interface{}
+	if config.xlsxOutput() {
+		rows, err = getXLSXData(config.XLSXPath, config.xlsxSheet())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Retrieved %d rows from %s\n", len(rows), config.XLSXPath)
+	} else {
+		rows, err = getSheetData(ctx, srv, config.sheetsRetry(), config.SpreadsheetID, config.Range)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get sheet data: %v", err)
 		}
+		fmt.Printf("Retrieved %d rows from Google Sheet\n", len(rows))
+	}
+
+	// Determine filterDate from the latest date near the end of the sheet,
+	// unless the search window was given explicitly.
+	var dynamicFilterDate string
+	if !opts.Since.IsZero() {
+		dynamicFilterDate = opts.Since.Format(dateFormat)
+		fmt.Printf("Using given filter date: %s\n", dynamicFilterDate)
 	} else {
-		fmt.Printf("Warning: No rows found in sheet, using default filter date: %s\n", fallbackFilterDate)
-		dynamicFilterDate = fallbackFilterDate
+		dynamicFilterDate = deriveFilterDate(rows, metricColumnIndex(config, "date"), config.FilterDateWindow,
+			config.sheetDateFormat(), config.startDate())
+		if gaps := sheetDateGaps(config, rows, nil); opts.FillGaps && len(gaps) > 0 && gaps[0] < dynamicFilterDate {
+			fmt.Printf("Searching from %s to fill %d day(s) missing from the sheet\n", gaps[0], len(gaps))
+			dynamicFilterDate = gaps[0]
+		}
+	}
+
+	// Never search before the listing went live.
+	var listingStart time.Time
+	if config.ListingStartDate != "" {
+		listingStart, err = time.Parse(dateFormat, config.ListingStartDate)
+		if err != nil {
+			return fmt.Errorf("invalid listing_start_date %q: %v", config.ListingStartDate, err)
+		}
+		listingStart = startOfDayIn(listingStart, loc)
+		if dynamicFilterDate < config.ListingStartDate {
+			fmt.Printf("Filter date %s is before listing start date; using %s\n", dynamicFilterDate, config.ListingStartDate)
+			dynamicFilterDate = config.ListingStartDate
+		}
 	}
 
 	// AccessYahoo Mail via IMAP
 	fmt.Println("Accessing Yahoo Mail via IMAP...")
-	emails, err := getYahooEmails(config.YahooUsername, config.YahooAppPassword, emailSubject, dynamicFilterDate)
+	// With a subject regex, the server can't do the matching, so fetch all
+	// emails since the filter date and match them here.
+	subject := config.subject()
+	if subjectRe != nil {
+		subject = ""
+	}
+	// Sheet and command-line dates are local days in the configured timezone;
+	// without one, they are taken as UTC days.
+	since, err := time.Parse(dateFormat, dynamicFilterDate)
 	if err != nil {
-		log.Fatalf("Failed to get Yahoo emails: %v", err)
+		return fmt.Errorf("invalid filter date: %v", err)
 	}
+	since = startOfDayIn(since, loc)
+	before := startOfDayIn(opts.Before, loc)
+	// With a UID state file, mailboxes with a recorded UID are searched for
+	// later UIDs instead, unless the search window was given explicitly.
+	useUIDState := config.UIDStateFile != "" && opts.Since.IsZero() && !opts.FillGaps
+	emails, err := getAccountEmails(ctx, config, subject, since, before, useUIDState)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Yahoo emails: %v", err)
+	}
+	if subjectRe != nil {
+		emails = filterBySubject(emails, subjectRe)
+	}
+	emails = dedupeEmails(config, emails)
 	fmt.Printf("Found %d emails since %s\n", len(emails), dynamicFilterDate)
+	logEvent("emails_found", "property", config.PropertyName, "since", dynamicFilterDate, "count", len(emails))
+
+	if loc != nil {
+		for _, email := range emails {
+			email.Date = email.Date.In(loc)
+			email.ReceivedDate = email.ReceivedDate.In(loc)
+		}
+	}
+
+	if !listingStart.IsZero() {
+		emails = skipEmailsBefore(emails, listingStart)
+	}
 
 	// Sort emails by date (oldest first)
 	sort.Slice(emails, func(i, j int) bool {
 		return emails[i].Date.Before(emails[j].Date)
 	})
 	fmt.Println("Sorted emails by date (oldest first)")
+	warnMissingReportDays(config, loc, emails, since, before)
 
 	// Process results
 	fmt.Println("Processing results...")
-	processData(srv, config, rows, emails)
-	return nil
+	recorded, written, err := processData(ctx, srv, config, opts, rows, emails)
+	totals.add(config, rows, emails, recorded)
+	if written.UpdatedRange != "" {
+		totals.Ranges = append(totals.Ranges, written.UpdatedRange)
+	}
+	if err == nil {
+		warnSheetGaps(config, rows, recorded)
+	}
+	if err == nil && config.UIDStateFile != "" && !opts.preview() {
+		if uidErr := saveRecordedUIDs(config, emails, recorded); uidErr != nil {
+			fmt.Printf("Warning: unable to update %s: %v\n", config.UIDStateFile, uidErr)
+		}
+	}
+	if err == nil && (config.MarkProcessed || config.ProcessedMailbox != "") && !opts.preview() {
+		if markErr := markProcessedEmails(ctx, config, recorded); markErr != nil {
+			fmt.Printf("Warning: unable to mark processed emails: %v\n", markErr)
+		}
+	}
+	if !opts.preview() {
+		run := propertyRun{Config: config, FilterDate: dynamicFilterDate,
+			Emails: emails, Recorded: recorded, Written: written, Err: err}
+		if opts.DeferReports {
+			totals.Runs = append(totals.Runs, run)
+		} else {
+			reportPropertyRun(run)
+		}
+	}
+	return err
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: zillowsaves <config.json>")
-		fmt.Println("Example config.json:")
-		fmt.Println(`{
-  "spreadsheet_id": "your-google-sheet-id",
-  "range": "Sheet1!A:Z", 
-  "yahoo_username": "your-email@yahoo.com",
-  "yahoo_app_password": "your-yahoo-app-password"
-}`)
-		fmt.Println("\nIMPORTANT: You need a Yahoo App Password!")
-		fmt.Println("Get one at: https://login.yahoo.com/account/security")
-		os.Exit(1)
-	}
+// What one property's run fetched and wrote, for its digest, post-run
+// command, and audit entry.
+type propertyRun struct {
+	Config     *Config
+	FilterDate string
+	Emails     []*EmailMessage
+	Recorded   []*EmailMessage
+	Written    writeResult
+	Err        error
+}
 
-	config, err := loadConfig(os.Args[1])
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+// Add a later run of the same property, such as the next backfill chunk.
+// The filter date stays that of the first run.
+func (r *propertyRun) merge(later propertyRun) {
+	r.Emails = append(r.Emails, later.Emails...)
+	r.Recorded = append(r.Recorded, later.Recorded...)
+	if later.Written.UpdatedRange != "" {
+		if r.Written.UpdatedRange != "" {
+			r.Written.UpdatedRange += ", "
+		}
+		r.Written.UpdatedRange += later.Written.UpdatedRange
 	}
+	r.Written.UpdatedRows += later.Written.UpdatedRows
+	r.Written.UpdatedCells += later.Written.UpdatedCells
+	if later.Err != nil {
+		r.Err = later.Err
+	}
+}
 
-	if err := doZillow(config); err != nil {
-		log.Fatalf("Zillow processing failed: %v", err)
+// Send the digest, run the post-run command, and write the audit entry for a
+// property's run, as configured.
+func reportPropertyRun(run propertyRun) {
+	config := run.Config
+	if config.SendDigest {
+		sendDigest(config, run.FilterDate, run.Emails, run.Recorded, run.Written, run.Err)
+	}
+	if run.Err == nil && config.PostRunCommand != "" {
+		runPostRunCommand(config.PostRunCommand, run.FilterDate, run.Recorded)
 	}
+	if config.AuditLog != "" {
+		writeAuditEntry(config.AuditLog, newAuditEntry(config.PropertyName, run.FilterDate, run.Emails, run.Recorded, run.Written, run.Err))
+	}
+}
+
+func main() {
+	zillow.Output = stdout{}
+	runCommand(os.Args[1:])
+}
+
+// Writes to standard output as it is when written, which -output moves to
+// standard error.
+type stdout struct{}
+
+func (stdout) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
 }
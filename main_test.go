@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeriveFilterDateColumn(t *testing.T) {
+	config := &Config{Range: "Sheet1!A:D", Columns: map[string]string{"date": "C", "saves": "D"}}
+	rows := [][]interface{}{
+		{"Note", "", "Date", "Saves"},
+		{"", "", "2025-08-01", "12"},
+		{"moved in", "", "2025-08-03", "14"},
+		{"", "", "2025-08-02", "13"},
+	}
+	got := deriveFilterDate(rows, metricColumnIndex(config, "date"), 0, dateFormat, "2025-05-21")
+	if want := "2025-08-04"; got != want {
+		t.Errorf("deriveFilterDate with the date in column C = %q, want %q", got, want)
+	}
+}
+
+// The report date in the body is used by default, even a day from the
+// envelope date, and only on a larger mismatch with date_source "envelope".
+func TestCheckReportDate(t *testing.T) {
+	envelope := time.Date(2025, 8, 31, 7, 12, 0, 0, time.UTC)
+	tests := []struct {
+		source string
+		text   string
+		want   string
+	}{
+		{"", "Report for August 30, 2025: 12 saves", "2025-08-30"},
+		{"report", "Report for August 30, 2025: 12 saves", "2025-08-30"},
+		{"", "12 saves", "2025-08-31"},
+		{"envelope", "Report for August 30, 2025: 12 saves", "2025-08-31"},
+		{"envelope", "Report for August 20, 2025: 12 saves", "2025-08-20"},
+	}
+	for _, tt := range tests {
+		email := &EmailMessage{Date: envelope, Text: tt.text}
+		checkReportDate(&Config{DateSource: tt.source}, email)
+		if got := email.Date.Format(dateFormat); got != tt.want {
+			t.Errorf("date_source %q, body %q: dated %s, want %s", tt.source, tt.text, got, tt.want)
+		}
+	}
+}
+
+// An email is skipped when its date is in the sheet, or when an earlier email
+// in the same batch has its date, such as a report found in two mailboxes.
+func TestSkipRecordedDates(t *testing.T) {
+	config := &Config{Range: "Sheet1!A:D"}
+	rows := [][]interface{}{
+		{"Date", "Saves", "Contacts", "Price/sqft"},
+		{"2025-08-01", "12", "2", "215"},
+	}
+	day := func(d int) time.Time { return time.Date(2025, 8, d, 7, 0, 0, 0, time.UTC) }
+	emails := []*EmailMessage{
+		{ID: "1", Date: day(1)},
+		{ID: "2", Date: day(2)},
+		{ID: "3", Date: day(2)},
+		{ID: "4", Date: day(3)},
+	}
+	var got []string
+	for _, email := range skipRecordedDates(config, rows, emails) {
+		got = append(got, email.ID)
+	}
+	if want := "2 4"; strings.Join(got, " ") != want {
+		t.Errorf("kept emails %v, want %s", got, want)
+	}
+}
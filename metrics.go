@@ -0,0 +1,54 @@
+// Write the outcome of each run as metrics in the Prometheus text format,
+// for node_exporter's textfile collector to pick up.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Write gauges for the run to filename. The file is replaced atomically, so
+// the collector never reads a partly written one. A run in which an email's
+// data couldn't be extracted counts as failed, as its exit status does;
+// finding no new data doesn't.
+func writeMetricsFile(filename string, totals runTotals, runErr error) error {
+	success := 1
+	if runErr != nil || totals.exitStatus() == exitExtractionFailed {
+		success = 0
+	}
+	var sb strings.Builder
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(&sb, "# HELP zillowsaves_%s %s\n", name, help)
+		fmt.Fprintf(&sb, "# TYPE zillowsaves_%s gauge\n", name)
+		fmt.Fprintf(&sb, "zillowsaves_%s %v\n", name, value)
+	}
+	gauge("last_run_timestamp_seconds", "Time the last run finished, in seconds since the epoch.", time.Now().Unix())
+	gauge("last_run_success", "Whether the last run completed without error (1), or failed or couldn't extract an email's data (0).", success)
+	gauge("emails_found", "Emails fetched in the last run.", totals.Fetched)
+	gauge("rows_appended", "Rows appended to the sheet in the last run.", totals.Appended)
+	gauge("duplicates_skipped", "Emails skipped in the last run because their dates were already recorded.", totals.Duplicates)
+	gauge("extraction_failures", "Emails in the last run whose saves count could not be extracted.", totals.ExtractionFailed)
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("unable to write metrics file: %v", err)
+	}
+	if _, err := tmp.WriteString(sb.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write metrics file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write metrics file: %v", err)
+	}
+	// The collector runs as another user, and CreateTemp makes the file 0600.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write metrics file: %v", err)
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsFileSuccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		totals runTotals
+		err    error
+		want   string
+	}{
+		{"appended", runTotals{Fetched: 1, Extracted: 1, Appended: 1}, nil, "1"},
+		{"no new data", runTotals{}, nil, "1"},
+		{"extraction failed", runTotals{Fetched: 2, ExtractionFailed: 2}, nil, "0"},
+		{"error", runTotals{}, errors.New("unable to read sheet"), "0"},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(t.TempDir(), "zillowsaves.prom")
+		if err := writeMetricsFile(filename, tt.totals, tt.err); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "\nzillowsaves_last_run_success " + tt.want + "\n"; !strings.Contains(string(data), want) {
+			t.Errorf("%s: metrics file lacks %q:\n%s", tt.name, strings.TrimSpace(want), data)
+		}
+	}
+}
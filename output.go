@@ -0,0 +1,45 @@
+// Print the data extracted in a run in a machine-readable form, for piping
+// into other tools.
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// emailResult is the data extracted from one email, as printed by -output.
+type emailResult struct {
+	Property     string      `json:"property,omitempty"`
+	Account      string      `json:"account,omitempty"`
+	Date         string      `json:"date"`
+	Saves        interface{} `json:"saves"` // The no-data placeholder for a forced NoData email.
+	Contacts     int         `json:"contacts"`
+	PricePerSqFt int         `json:"price_per_sqft"`
+	Subject      string      `json:"subject"`
+	ID           string      `json:"id"`
+	Recorded     bool        `json:"recorded"` // Written to the sheet in this run.
+}
+
+func newEmailResult(config *Config, email *EmailMessage, recorded bool) emailResult {
+	return emailResult{
+		Property:     config.PropertyName,
+		Account:      email.Account,
+		Date:         email.Date.Format(dateFormat),
+		Saves:        emailMetrics(config, email)["saves"],
+		Contacts:     email.Contacts,
+		PricePerSqFt: email.PricePerSqFt,
+		Subject:      email.Subject,
+		ID:           email.ID,
+		Recorded:     recorded,
+	}
+}
+
+// Write the results as a JSON array, oldest first within each property.
+func writeResultsJSON(w io.Writer, results []emailResult) error {
+	if results == nil {
+		results = []emailResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
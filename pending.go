@@ -0,0 +1,151 @@
+// Preserve rows that could not be written because the Google Sheets daily
+// write quota was exhausted, and write them on the next run.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+const defaultPendingFile = "zillowsaves-pending.json"
+
+// dailyQuotaError indicates that an append failed because the daily write
+// quota was exceeded. Rows holds the values that were not written.
+type dailyQuotaError struct {
+	Rows [][]interface{}
+	Err  error
+}
+
+func (e *dailyQuotaError) Error() string {
+	return fmt.Sprintf("daily Google Sheets write quota exceeded: %v", e.Err)
+}
+
+func (e *dailyQuotaError) Unwrap() error {
+	return e.Err
+}
+
+// Report whether a Sheets API error is the per-day quota being exhausted,
+// as opposed to a transient per-minute rate limit.
+func isDailyQuotaError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 429 {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	for _, item := range apiErr.Errors {
+		msg += " " + strings.ToLower(item.Reason+" "+item.Message)
+	}
+	return strings.Contains(msg, "per day") || strings.Contains(msg, "dailylimitexceeded")
+}
+
+func pendingFilename(config *Config) string {
+	if config.PendingFile != "" {
+		return config.PendingFile
+	}
+	return defaultPendingFile
+}
+
+// pendingBatch is a set of unwritten rows and the spreadsheet and range they
+// belong to. Files saved before properties could name their own spreadsheet
+// have no spreadsheet ID; their rows go to the top-level one.
+type pendingBatch struct {
+	SpreadsheetID string          `json:"spreadsheet_id,omitempty"`
+	Range         string          `json:"range"`
+	Rows          [][]interface{} `json:"rows"`
+}
+
+// If err is a daily quota error, save the unwritten rows to the pending file
+// and return an error telling the user to resume tomorrow. Other errors are
+// returned unchanged.
+func handleDailyQuotaError(config *Config, err error) error {
+	if err == nil {
+		return nil
+	}
+	var quotaErr *dailyQuotaError
+	if !errors.As(err, &quotaErr) {
+		return err
+	}
+	filename := pendingFilename(config)
+	existing, loadErr := loadPendingBatches(filename)
+	if loadErr == nil {
+		loadErr = savePendingBatches(filename, append(existing, pendingBatch{SpreadsheetID: config.SpreadsheetID, Range: config.Range, Rows: quotaErr.Rows}))
+	}
+	if loadErr != nil {
+		return fmt.Errorf("%v; additionally unable to save unwritten rows to %s: %v", err, filename, loadErr)
+	}
+	return fmt.Errorf("%v\n%d unwritten rows were saved to %s; run again tomorrow to resume",
+		err, len(quotaErr.Rows), filename)
+}
+
+// Write the pending file, or remove it if there are no pending rows.
+func savePendingBatches(filename string, batches []pendingBatch) error {
+	if len(batches) == 0 {
+		err := os.Remove(filename)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(batches, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// Load the pending file. A missing file means there are no pending rows.
+func loadPendingBatches(filename string) ([]pendingBatch, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var batches []pendingBatch
+	if err := json.Unmarshal(data, &batches); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", filename, err)
+	}
+	return batches, nil
+}
+
+// Append rows saved by an earlier run to the sheet, removing them from the
+// pending file as they are written.
+func flushPendingRows(ctx context.Context, srv *sheets.Service, config *Config) error {
+	filename := pendingFilename(config)
+	batches, err := loadPendingBatches(filename)
+	if err != nil {
+		return fmt.Errorf("unable to load pending rows: %v", err)
+	}
+
+	for len(batches) > 0 {
+		batch := batches[0]
+		spreadsheetID := batch.SpreadsheetID
+		if spreadsheetID == "" {
+			spreadsheetID = config.SpreadsheetID
+		}
+		fmt.Printf("Appending %d pending rows for %s from %s...\n", len(batch.Rows), batch.Range, filename)
+		if _, err := appendValues(ctx, srv, config.sheetsRetry(), config.valueInputOption(), spreadsheetID, batch.Range, batch.Rows); err != nil {
+			if errors.As(err, new(*dailyQuotaError)) {
+				// The rows are still in the pending file.
+				return fmt.Errorf("%v\nPending rows remain in %s; run again tomorrow to resume", err, filename)
+			}
+			return err
+		}
+		fmt.Printf("Successfully appended %d pending rows to Google Sheet\n", len(batch.Rows))
+
+		batches = batches[1:]
+		if err := savePendingBatches(filename, batches); err != nil {
+			return fmt.Errorf("appended pending rows but unable to update %s: %v", filename, err)
+		}
+	}
+	return nil
+}
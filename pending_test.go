@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Rows deferred for a property with its own spreadsheet are written to that
+// spreadsheet, and rows from an older pending file to the top-level one.
+func TestFlushPendingRowsSpreadsheets(t *testing.T) {
+	fake, srv := startFakeSheets(t, nil)
+	config := &Config{
+		SpreadsheetID: "top",
+		Range:         "Sheet1!A:D",
+		PendingFile:   filepath.Join(t.TempDir(), "pending.json"),
+		SheetsRetries: -1,
+	}
+	property := *config
+	property.SpreadsheetID = "lakeshore"
+	err := handleDailyQuotaError(&property, &dailyQuotaError{Rows: [][]interface{}{{"2025-08-01", 12, 2, 215}}})
+	if err == nil {
+		t.Fatal("handleDailyQuotaError returned nil for a quota error")
+	}
+	batches, err := loadPendingBatches(config.PendingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches = append(batches, pendingBatch{Range: "Sheet1!A:D", Rows: [][]interface{}{{"2025-08-02", 13, 2, 215}}})
+	if err := savePendingBatches(config.PendingFile, batches); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := flushPendingRows(context.Background(), srv, config); err != nil {
+		t.Fatalf("flushPendingRows: %v", err)
+	}
+	if got, want := fake.rows("lakeshore"), [][]string{{"2025-08-01", "12", "2", "215"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lakeshore spreadsheet = %q, want %q", got, want)
+	}
+	if got, want := fake.rows("top"), [][]string{{"2025-08-02", "13", "2", "215"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("top-level spreadsheet = %q, want %q", got, want)
+	}
+	if batches, err := loadPendingBatches(config.PendingFile); err != nil || len(batches) != 0 {
+		t.Errorf("pending file still holds %d batches (error %v)", len(batches), err)
+	}
+}
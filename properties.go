@@ -0,0 +1,194 @@
+// Track several listings in one run, each with its own settings.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PropertyConfig holds the settings for one listing. Empty fields take
+// their values from the top-level Config.
+type PropertyConfig struct {
+	Name          string `json:"name"`
+	EmailSubject  string `json:"email_subject"`
+	SubjectRegex  string `json:"subject_regex"`
+	SpreadsheetID string `json:"spreadsheet_id"`
+	Range         string `json:"range"`
+	SheetName     string `json:"sheet_name"`
+	XLSXSheet     string `json:"xlsx_sheet"`
+	Timezone      string `json:"timezone"`
+	DateFormat    string `json:"date_format"`
+	Mailbox       string `json:"mailbox"`
+	StartDate     string `json:"start_date"`
+	CSVFile       string `json:"csv_file"`
+}
+
+// Return a Config for each property to process, with the property's
+// settings overriding the top-level ones. With no properties configured,
+// the top-level Config describes the single property.
+func propertyConfigs(config *Config) []*Config {
+	if len(config.Properties) == 0 {
+		return []*Config{config}
+	}
+
+	var configs []*Config
+	for _, p := range config.Properties {
+		c := *config
+		c.Properties = nil
+		c.PropertyName = p.Name
+		if p.EmailSubject != "" {
+			c.EmailSubject = p.EmailSubject
+			// An explicit subject for the property replaces a global regex.
+			c.SubjectRegex = ""
+		}
+		if p.SubjectRegex != "" {
+			c.SubjectRegex = p.SubjectRegex
+		}
+		if p.SpreadsheetID != "" {
+			c.SpreadsheetID = p.SpreadsheetID
+		}
+		if p.Range != "" {
+			c.Range = p.Range
+			c.SheetName = ""
+		}
+		if p.SheetName != "" {
+			c.SheetName = p.SheetName
+		}
+		if p.XLSXSheet != "" {
+			c.XLSXSheet = p.XLSXSheet
+		}
+		if p.Timezone != "" {
+			c.Timezone = p.Timezone
+		}
+		if p.DateFormat != "" {
+			c.DateFormat = p.DateFormat
+		}
+		if p.Mailbox != "" {
+			c.Mailbox = p.Mailbox
+			c.Mailboxes = nil
+		}
+		if p.StartDate != "" {
+			c.StartDate = p.StartDate
+		}
+		if p.CSVFile != "" {
+			c.CSVFile = p.CSVFile
+		}
+		configs = append(configs, &c)
+	}
+	return configs
+}
+
+// Return the date to search from while the sheet has no dates: StartDate,
+// or else the listing start date, or else fallbackFilterDate.
+func (c *Config) startDate() string {
+	switch {
+	case c.StartDate != "":
+		return c.StartDate
+	case c.ListingStartDate != "":
+		return c.ListingStartDate
+	}
+	return fallbackFilterDate
+}
+
+// Return the subject to search for.
+func (c *Config) subject() string {
+	if c.EmailSubject != "" {
+		return c.EmailSubject
+	}
+	return emailSubject
+}
+
+// Return the words to look for in subjects when none matches subject: the
+// name of the report, and the property address after the subject's colon,
+// e.g. "9121 Blackhawk Rd" in "Your Daily Listing Report: 9121 Blackhawk Rd".
+func similarSubjects(subject string) []string {
+	words := []string{"Listing Report"}
+	if i := strings.LastIndex(subject, ":"); i >= 0 {
+		if address := strings.TrimSpace(subject[i+1:]); address != "" {
+			words = append(words, address)
+		}
+	}
+	return words
+}
+
+// Return the layout used to write dates to the sheet.
+func (c *Config) sheetDateFormat() string {
+	if c.DateFormat != "" {
+		return c.DateFormat
+	}
+	return dateFormat
+}
+
+// Return the ValueInputOption for writes to the sheet.
+func (c *Config) valueInputOption() string {
+	if c.ValueInputOption != "" {
+		return c.ValueInputOption
+	}
+	return "RAW"
+}
+
+// Return the mailboxes to search.
+func (c *Config) searchMailboxes() []string {
+	mailboxes := []string{"INBOX"}
+	if len(c.Mailboxes) > 0 {
+		mailboxes = c.Mailboxes
+	} else if c.Mailbox != "" {
+		mailboxes = []string{c.Mailbox}
+	}
+	provider := c.imapProvider()
+	var names []string
+	for _, mailbox := range mailboxes {
+		names = append(names, provider.folder(mailbox))
+	}
+	return names
+}
+
+// Return the location in which email dates are recorded. Without a
+// configured timezone, dates are recorded in the sender's zone.
+func (c *Config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// Return midnight at the start of t's calendar date in loc, so that a date
+// read from the sheet or the command line marks the start of that local day
+// when compared with email times. t is returned unchanged if it is zero or
+// loc is nil.
+func startOfDayIn(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() || loc == nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// Return the compiled subject regex, or nil if none is configured.
+func (c *Config) subjectRegex() (*regexp.Regexp, error) {
+	if c.SubjectRegex == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(c.SubjectRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject_regex %q: %v", c.SubjectRegex, err)
+	}
+	return re, nil
+}
+
+// Drop emails whose subject does not match the regex.
+func filterBySubject(emails []*EmailMessage, re *regexp.Regexp) []*EmailMessage {
+	var kept []*EmailMessage
+	for _, email := range emails {
+		if !re.MatchString(email.Subject) {
+			continue
+		}
+		kept = append(kept, email)
+	}
+	return kept
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPropertyConfigsOverrides(t *testing.T) {
+	config := &Config{
+		EmailSubject: "Your Daily Listing Report: 9121 Blackhawk Rd",
+		SubjectRegex: `Listing Report`,
+		Timezone:     "America/Chicago",
+		DateFormat:   "1/2/2006",
+		Mailboxes:    []string{"INBOX", "Archive"},
+		Properties: []PropertyConfig{
+			{Name: "Blackhawk"},
+			{
+				Name:         "Lakeshore",
+				EmailSubject: "Your Daily Listing Report: 12 Lakeshore Dr",
+				Timezone:     "America/Los_Angeles",
+				DateFormat:   "2006-01-02",
+				Mailbox:      "Zillow",
+			},
+			{Name: "Regex", SubjectRegex: `Listing Report: \d+ Elm St`},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		subject      string
+		subjectRegex string
+		timezone     string
+		dateFormat   string
+		mailbox      string
+		mailboxes    []string
+	}{
+		// Settings the property omits are the top-level ones.
+		{"Blackhawk", "Your Daily Listing Report: 9121 Blackhawk Rd", `Listing Report`, "America/Chicago", "1/2/2006", "", []string{"INBOX", "Archive"}},
+		// An explicit subject replaces the top-level regex, and a mailbox
+		// replaces the top-level mailbox list.
+		{"Lakeshore", "Your Daily Listing Report: 12 Lakeshore Dr", "", "America/Los_Angeles", "2006-01-02", "Zillow", nil},
+		{"Regex", "Your Daily Listing Report: 9121 Blackhawk Rd", `Listing Report: \d+ Elm St`, "America/Chicago", "1/2/2006", "", []string{"INBOX", "Archive"}},
+	}
+	configs := propertyConfigs(config)
+	if len(configs) != len(tests) {
+		t.Fatalf("propertyConfigs returned %d configs, want %d", len(configs), len(tests))
+	}
+	for i, tt := range tests {
+		c := configs[i]
+		if c.PropertyName != tt.name {
+			t.Errorf("config %d is for %q, want %q", i, c.PropertyName, tt.name)
+		}
+		if c.EmailSubject != tt.subject || c.SubjectRegex != tt.subjectRegex {
+			t.Errorf("%s: subject %q, regex %q; want %q, %q", tt.name, c.EmailSubject, c.SubjectRegex, tt.subject, tt.subjectRegex)
+		}
+		if c.Timezone != tt.timezone {
+			t.Errorf("%s: timezone %q, want %q", tt.name, c.Timezone, tt.timezone)
+		}
+		if c.sheetDateFormat() != tt.dateFormat {
+			t.Errorf("%s: date format %q, want %q", tt.name, c.sheetDateFormat(), tt.dateFormat)
+		}
+		if c.Mailbox != tt.mailbox || !reflect.DeepEqual(c.Mailboxes, tt.mailboxes) {
+			t.Errorf("%s: mailbox %q, mailboxes %q; want %q, %q", tt.name, c.Mailbox, c.Mailboxes, tt.mailbox, tt.mailboxes)
+		}
+		if len(c.Properties) != 0 {
+			t.Errorf("%s: config still lists %d properties", tt.name, len(c.Properties))
+		}
+	}
+	if config.Timezone != "America/Chicago" || config.EmailSubject != "Your Daily Listing Report: 9121 Blackhawk Rd" {
+		t.Errorf("propertyConfigs changed the top-level config")
+	}
+}
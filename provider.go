@@ -0,0 +1,96 @@
+// Defaults for the IMAP servers of the common mail providers, so that using
+// one only needs the provider's name.
+package main
+
+import (
+	"strings"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// imapProvider holds a mail provider's IMAP server, default login methods,
+// OAuth2 settings for XOAUTH2, and the names of its special folders.
+type imapProvider struct {
+	Name             string
+	Host             string
+	Port             int
+	AuthMethods      []string // Nil for the app password.
+	OAuthEndpoint    oauth2.Endpoint
+	OAuthScopes      []string
+	OAuthRedirectURL string
+	// In place of OAuthScopes when emails are marked or moved once recorded,
+	// if reading alone needs a narrower scope.
+	OAuthWriteScopes []string
+	// The provider's folders for the generic names "spam" and "archive".
+	Folders map[string]string
+}
+
+const defaultProvider = "yahoo"
+
+var imapProviders = map[string]imapProvider{
+	"yahoo": {
+		Name: "yahoo",
+		Host: "imap.mail.yahoo.com",
+		Port: 993,
+		OAuthEndpoint: oauth2.Endpoint{
+			AuthURL:  "https://api.login.yahoo.com/oauth2/request_auth",
+			TokenURL: "https://api.login.yahoo.com/oauth2/get_token",
+		},
+		OAuthScopes:      []string{"mail-r"},
+		OAuthWriteScopes: []string{"mail-w"},
+		OAuthRedirectURL: "oob",
+		Folders:          map[string]string{"spam": "Bulk", "archive": "Archive"},
+	},
+	"gmail": {
+		Name:             "gmail",
+		Host:             "imap.gmail.com",
+		Port:             993,
+		OAuthEndpoint:    google.Endpoint,
+		OAuthScopes:      []string{"https://mail.google.com/"},
+		OAuthRedirectURL: "http://localhost",
+		Folders:          map[string]string{"spam": "[Gmail]/Spam", "archive": "[Gmail]/All Mail"},
+	},
+	"outlook": {
+		// Outlook.com and Microsoft 365 no longer accept basic auth for IMAP.
+		Name:        "outlook",
+		Host:        "outlook.office365.com",
+		Port:        993,
+		AuthMethods: []string{zillow.AuthMethodOAuth2},
+		OAuthEndpoint: oauth2.Endpoint{
+			AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+			TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		},
+		OAuthScopes:      []string{"https://outlook.office.com/IMAP.AccessAsUser.All", "offline_access"},
+		OAuthRedirectURL: "https://login.microsoftonline.com/common/oauth2/nativeclient",
+		Folders:          map[string]string{"spam": "Junk", "archive": "Archive"},
+	},
+}
+
+// Return the configured mail provider, or Yahoo if none is.
+func (c *Config) imapProvider() imapProvider {
+	if provider, ok := imapProviders[c.Provider]; ok {
+		return provider
+	}
+	return imapProviders[defaultProvider]
+}
+
+// Return the OAuth2 scopes to request from the provider: write access if
+// recorded emails are marked or moved, and otherwise read access.
+func (c *Config) imapOAuthScopes() []string {
+	provider := c.imapProvider()
+	if (c.MarkProcessed || c.ProcessedMailbox != "") && provider.OAuthWriteScopes != nil {
+		return provider.OAuthWriteScopes
+	}
+	return provider.OAuthScopes
+}
+
+// Return the provider's name for a mailbox: its own folder for "spam" or
+// "archive" (in any case), and otherwise the name as given.
+func (p imapProvider) folder(mailbox string) string {
+	if folder, ok := p.Folders[strings.ToLower(mailbox)]; ok {
+		return folder
+	}
+	return mailbox
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Yahoo's read-only scope can't flag or move emails, so write access is
+// requested when they are marked once recorded.
+func TestIMAPOAuthScopes(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   []string
+	}{
+		{Config{}, []string{"mail-r"}},
+		{Config{MarkProcessed: true}, []string{"mail-w"}},
+		{Config{ProcessedMailbox: "Processed"}, []string{"mail-w"}},
+		{Config{Provider: "gmail", MarkProcessed: true}, []string{"https://mail.google.com/"}},
+	}
+	for _, tt := range tests {
+		if got := tt.config.imapOAuthScopes(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scopes for %+v = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Re-extract the saves counts of the latest sheet rows from their emails,
+// to catch counts that were extracted wrongly when they were recorded.
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A sheet row to reverify: its date and recorded saves count.
+type reverifyRow struct {
+	date  time.Time
+	saves string
+}
+
+// Return the last n rows of the sheet with a date, oldest first.
+func lastDatedRows(config *Config, rows [][]interface{}, n int) []reverifyRow {
+	dateIndex := metricColumnIndex(config, "date")
+	savesIndex := metricColumnIndex(config, "saves")
+	var dated []reverifyRow
+	for i := len(rows) - 1; i >= 0 && len(dated) < n; i-- {
+		row := rows[i]
+		if dateIndex >= len(row) {
+			continue
+		}
+		date, err := parseSheetDate(strings.TrimSpace(fmt.Sprintf("%v", row[dateIndex])), config.sheetDateFormat())
+		if err != nil {
+			continue
+		}
+		saves := ""
+		if savesIndex < len(row) {
+			saves = strings.TrimSpace(fmt.Sprintf("%v", row[savesIndex]))
+		}
+		dated = append(dated, reverifyRow{date, saves})
+	}
+	sort.Slice(dated, func(i, j int) bool { return dated[i].date.Before(dated[j].date) })
+	return dated
+}
+
+// Fetch the emails for the property's last n dated rows, extract their saves
+// counts again, and report each that differs from the sheet. With update,
+// the sheet is corrected. Returns the number of mismatches.
+func reverifyProperty(ctx context.Context, config *Config, n int, update bool) (int, error) {
+	if config.xlsxOutput() {
+		return 0, fmt.Errorf("reverify reads only Google Sheets, not with output_mode \"xlsx\"")
+	}
+	loc, err := config.location()
+	if err != nil {
+		return 0, err
+	}
+	subjectRe, err := config.subjectRegex()
+	if err != nil {
+		return 0, err
+	}
+	srv, err := newSheetsService(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	if config, err = withSheetRange(ctx, srv, config); err != nil {
+		return 0, err
+	}
+	if metricColumnIndex(config, "date") < 0 || metricColumnIndex(config, "saves") < 0 {
+		return 0, fmt.Errorf("the date and saves columns must both be recorded to reverify rows")
+	}
+	rows, err := getSheetData(ctx, srv, config.sheetsRetry(), config.SpreadsheetID, config.Range)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sheet data: %v", err)
+	}
+	dated := lastDatedRows(config, rows, n)
+	if len(dated) == 0 {
+		fmt.Println("No dated rows in the sheet to reverify")
+		return 0, nil
+	}
+
+	subject := config.subject()
+	if subjectRe != nil {
+		subject = ""
+	}
+	since := startOfDayIn(dated[0].date, loc)
+	before := startOfDayIn(dated[len(dated)-1].date.AddDate(0, 0, 1), loc)
+	fmt.Printf("Reverifying %d rows from %s to %s\n", len(dated),
+		dated[0].date.Format(dateFormat), dated[len(dated)-1].date.Format(dateFormat))
+	emails, err := getAccountEmails(ctx, config, subject, since, before, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Yahoo emails: %v", err)
+	}
+	if subjectRe != nil {
+		emails = filterBySubject(emails, subjectRe)
+	}
+	emails = dedupeEmails(config, emails)
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].Date.Before(emails[j].Date)
+	})
+
+	// As when recording, the first email for a day is the one used.
+	fresh := make(map[string]int)
+	for _, email := range emails {
+		if loc != nil {
+			email.Date = email.Date.In(loc)
+		}
+		if err := extractEmailData(config, email, runOptions{}); err != nil {
+			fmt.Printf("  Unable to reverify email %s: %v\n\n", email.ID, err)
+			continue
+		}
+		fmt.Println()
+		day := email.Date.Format(dateFormat)
+		if _, ok := fresh[day]; !ok {
+			fresh[day] = email.ZillowSaves
+		}
+	}
+
+	mismatches, missing := 0, 0
+	for _, row := range dated {
+		day := row.date.Format(dateFormat)
+		count, ok := fresh[day]
+		if !ok {
+			fmt.Printf("%s: no email found; recorded %q\n", day, row.saves)
+			missing++
+			continue
+		}
+		if strings.ReplaceAll(row.saves, ",", "") == strconv.Itoa(count) {
+			fmt.Printf("%s: OK (%d)\n", day, count)
+			continue
+		}
+		mismatches++
+		fmt.Printf("%s: MISMATCH: sheet has %q, email has %d\n", day, row.saves, count)
+		logEvent("reverify_mismatch", "property", config.PropertyName, "date", day, "recorded", row.saves, "saves", count)
+		if update {
+			if err := updateSavesCell(ctx, srv, config, row.date, count, false); err != nil {
+				return mismatches, err
+			}
+		}
+	}
+	fmt.Printf("Reverified %d rows: %d mismatches, %d without an email\n", len(dated), mismatches, missing)
+	return mismatches, nil
+}
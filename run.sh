@@ -31,7 +31,7 @@ fi
 
 # Build the program
 echo "Building ZillowSaves..."
-go build -o zillowsaves .
+go build -ldflags "-X main.commit=$(git rev-parse --short HEAD 2>/dev/null || echo unknown) -X main.buildDate=$(date -u +%Y-%m-%d)" -o zillowsaves .
 if [ $? -ne 0 ]; then
     echo "❌ Build failed"
     exit 1
@@ -0,0 +1,48 @@
+// Optional log file of the main events of each run, for reviewing
+// unattended (e.g. cron) runs later.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+)
+
+// The log file opened by openRunLog, or nil if log_file isn't set.
+var runLog *log.Logger
+
+// Open the configured log file for appending.
+func openRunLog(config *Config) error {
+	if config.LogFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file %s: %v", config.LogFile, err)
+	}
+	runLog = log.New(f, "", log.LstdFlags)
+	zillow.LogEvent = logEvent
+	return nil
+}
+
+// Write an event to the log file as a line of key=value fields, e.g.
+// logEvent("rows_appended", "property", "Elm", "rows", 2). Does nothing
+// without a log file.
+func logEvent(event string, keyValues ...interface{}) {
+	if runLog == nil {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("event=" + event)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		value := fmt.Sprintf("%v", keyValues[i+1])
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&sb, " %v=%s", keyValues[i], value)
+	}
+	runLog.Println(sb.String())
+}
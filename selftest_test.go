@@ -0,0 +1,109 @@
+// Run .eml fixtures through the extraction pipeline and compare the rows
+// that would be appended to the sheet against a golden file.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+)
+
+// Directory holding the .eml fixtures and their golden file.
+const fixtureDir = "testdata/eml"
+
+// Name of the file in the fixture directory listing the expected rows, one
+// comma-separated row per line.
+const goldenFilename = "golden.txt"
+
+// Format a sheet row as it appears in the golden file.
+func formatGoldenRow(row []interface{}) string {
+	fields := make([]string, len(row))
+	for i, v := range row {
+		fields[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(fields, ",")
+}
+
+// Process every fixture, oldest first, and check that the resulting rows
+// match the golden file.
+func TestGolden(t *testing.T) {
+	emails, err := loadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGoldenRows(t, fixtureDir, emails)
+}
+
+// Load every .eml file in dir.
+func loadFixtures(dir string) ([]*EmailMessage, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no .eml files found in %s", dir)
+	}
+
+	var emails []*EmailMessage
+	for _, filename := range filenames {
+		email, err := loadEmailFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// Extract the data from emails, oldest first, and check that the resulting
+// rows match the golden file in dir.
+func checkGoldenRows(t *testing.T, dir string, emails []*EmailMessage) {
+	t.Helper()
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].Date.Before(emails[j].Date)
+	})
+
+	// As in processData, an email with no saves count is skipped, so it has
+	// no golden row.
+	var extracted []*EmailMessage
+	for _, email := range emails {
+		err := extractEmailData(&Config{}, email, runOptions{})
+		if err == zillow.ErrNoSavesCount {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("extraction failed for %s: %v", email.ID, err)
+		}
+		extracted = append(extracted, email)
+	}
+
+	// Stand in for the sheet by collecting the rows that would be appended.
+	var got []string
+	for _, row := range sheetRows(&Config{}, extracted) {
+		got = append(got, formatGoldenRow(row))
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, goldenFilename))
+	if err != nil {
+		t.Fatalf("unable to read golden file: %v", err)
+	}
+	want := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	for i := 0; i < len(got) || i < len(want); i++ {
+		var g, w string
+		if i < len(got) {
+			g = got[i]
+		}
+		if i < len(want) {
+			w = strings.TrimSpace(want[i])
+		}
+		if g != w {
+			t.Errorf("row %d: got %q, want %q", i+1, g, w)
+		}
+	}
+}
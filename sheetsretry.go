@@ -0,0 +1,125 @@
+// Retry Google Sheets API calls that fail transiently, with 429 (the
+// per-minute rate limit) or a 5xx error, so that a brief problem at Google
+// doesn't fail a whole cron run.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultSheetsRetries    = 3
+	defaultSheetsRetryDelay = 2 * time.Second
+)
+
+// How often to retry a Sheets API call that fails transiently.
+type sheetsRetry struct {
+	Retries   int           // After the first attempt; negative means none.
+	BaseDelay time.Duration // Before the first retry, unless the response gives a Retry-After; doubled for each one after.
+}
+
+// Return the configured retry policy for Sheets API calls.
+func (c *Config) sheetsRetry() sheetsRetry {
+	retry := sheetsRetry{
+		Retries:   c.SheetsRetries,
+		BaseDelay: time.Duration(c.SheetsRetryDelay) * time.Second,
+	}
+	if retry.Retries == 0 {
+		retry.Retries = defaultSheetsRetries
+	}
+	if retry.BaseDelay == 0 {
+		retry.BaseDelay = defaultSheetsRetryDelay
+	}
+	return retry
+}
+
+// Report whether a Sheets API error is worth retrying. The daily quota
+// isn't, since it won't be replenished until tomorrow; see pending.go.
+func isTransientSheetsError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests:
+		return isRateLimitError(err)
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Report whether a Sheets API error is the per-minute rate limit, which
+// rejects a request without carrying it out.
+func isRateLimitError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests && !isDailyQuotaError(err)
+}
+
+// Return how long the Retry-After header of a Sheets API error asks the
+// client to wait, if it has one, in seconds or as an HTTP date.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Header == nil {
+		return 0, false
+	}
+	value := apiErr.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Call a Sheets API request, described by what, retrying transient failures
+// with exponential backoff, or after the delay in a Retry-After header.
+func withSheetsRetry(ctx context.Context, retry sheetsRetry, what string, call func() error) error {
+	return retrySheetsCall(ctx, retry, what, isTransientSheetsError, call)
+}
+
+// Like withSheetsRetry, but retry only the rate limit, for a request that
+// isn't safe to repeat, such as an append: after a 5xx error, the server
+// may have carried it out anyway.
+func withSheetsRateLimitRetry(ctx context.Context, retry sheetsRetry, what string, call func() error) error {
+	return retrySheetsCall(ctx, retry, what, isRateLimitError, call)
+}
+
+// Call a Sheets API request, retrying the failures for which retryable is
+// true.
+func retrySheetsCall(ctx context.Context, retry sheetsRetry, what string, retryable func(error) bool, call func() error) error {
+	delay := retry.BaseDelay
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !retryable(err) || attempt >= retry.Retries {
+			return err
+		}
+		wait := delay
+		if after, ok := retryAfter(err); ok {
+			wait = after
+		}
+		logEvent("sheets_retry", "request", what, "attempt", attempt+1, "error", err)
+		fmt.Printf("Google Sheets %s failed: %v; retrying in %v (retry %d of %d)\n",
+			what, err, wait, attempt+1, retry.Retries)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// An append that fails with a server error is not retried, since it may
+// have been written; one rejected by the rate limit is.
+func TestAppendRetries(t *testing.T) {
+	values := [][]interface{}{{"2025-08-01", 12, 2, 215}}
+	tests := []struct {
+		name     string
+		statuses []int
+		wantErr  bool
+		appends  int
+	}{
+		{"server error", []int{http.StatusServiceUnavailable, http.StatusOK}, true, 1},
+		{"gateway timeout", []int{http.StatusGatewayTimeout, http.StatusOK}, true, 1},
+		{"rate limit", []int{http.StatusTooManyRequests, http.StatusOK}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, srv := startFakeSheets(t, nil)
+			fake.appendStatuses = tt.statuses
+			retry := sheetsRetry{Retries: 3, BaseDelay: time.Millisecond}
+			_, err := appendValues(context.Background(), srv, retry, "RAW", "sheet", "Sheet1!A:D", values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("appendValues error = %v, want error %v", err, tt.wantErr)
+			}
+			if fake.appends != tt.appends {
+				t.Errorf("sent %d appends, want %d", fake.appends, tt.appends)
+			}
+			if got, want := fake.rows("sheet"), [][]string{{"2025-08-01", "12", "2", "215"}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("sheet = %q, want the row once: %q", got, want)
+			}
+		})
+	}
+}
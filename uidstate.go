@@ -0,0 +1,106 @@
+// Track the highest IMAP UID recorded in each mailbox, so that a run can
+// search for messages after it rather than from the sheet's latest date.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+)
+
+// uidState is the last UID recorded from a mailbox; see zillow.UIDState.
+type uidState = zillow.UIDState
+
+// Return the key for a mailbox in the state file; each property has its
+// own, since properties may share a mailbox, as does each account.
+func uidStateKey(property, account, mailbox string) string {
+	key := mailbox
+	if account != "" {
+		key = account + "/" + key
+	}
+	if property != "" {
+		key = property + "/" + key
+	}
+	return key
+}
+
+// Read the state file; a missing file is an empty state.
+func loadUIDStates(filename string) (map[string]uidState, error) {
+	states := make(map[string]uidState)
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", filename, err)
+	}
+	return states, nil
+}
+
+// Return the last recorded UID of each of the property's mailboxes that
+// have one, keyed by mailbox.
+func propertyUIDStates(config *Config) (map[string]uidState, error) {
+	states, err := loadUIDStates(config.UIDStateFile)
+	if err != nil {
+		return nil, err
+	}
+	byMailbox := make(map[string]uidState)
+	for _, mailbox := range config.searchMailboxes() {
+		if state, ok := states[uidStateKey(config.PropertyName, config.AccountName, mailbox)]; ok {
+			byMailbox[mailbox] = state
+		}
+	}
+	return byMailbox, nil
+}
+
+// Advance the state of each mailbox to the highest UID of the recorded
+// emails in it, but not past a fetched email whose data could not be
+// extracted, so that the next run fetches that email again.
+func saveRecordedUIDs(config *Config, emails, recorded []*EmailMessage) error {
+	states, err := loadUIDStates(config.UIDStateFile)
+	if err != nil {
+		return err
+	}
+	// The lowest failed UID in each mailbox.
+	failed := make(map[string]uint32)
+	for _, email := range emails {
+		if email.UID == 0 || email.ZillowSaves >= 0 {
+			continue
+		}
+		key := uidStateKey(config.PropertyName, email.Account, email.Mailbox)
+		if uid, ok := failed[key]; !ok || email.UID < uid {
+			failed[key] = email.UID
+		}
+	}
+	changed := false
+	for _, email := range recorded {
+		key := uidStateKey(config.PropertyName, email.Account, email.Mailbox)
+		last := email.UID
+		if uid, ok := failed[key]; ok && last >= uid {
+			last = uid - 1
+		}
+		if last == 0 {
+			continue
+		}
+		state, ok := states[key]
+		if ok && state.UIDValidity == email.UIDValidity && state.LastUID >= last {
+			continue
+		}
+		states[key] = uidState{UIDValidity: email.UIDValidity, LastUID: last}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.UIDStateFile, data, 0600)
+}
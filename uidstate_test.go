@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// The state doesn't move past an email whose data couldn't be extracted,
+// even when later emails in the mailbox were recorded.
+func TestSaveRecordedUIDsStopsBeforeFailure(t *testing.T) {
+	config := &Config{UIDStateFile: filepath.Join(t.TempDir(), "uids.json")}
+	email := func(mailbox string, uid uint32, saves int) *EmailMessage {
+		return &EmailMessage{Mailbox: mailbox, UID: uid, UIDValidity: 7, ZillowSaves: saves}
+	}
+	inboxRecorded := []*EmailMessage{email("INBOX", 10, 12), email("INBOX", 12, 14)}
+	inboxFailed := email("INBOX", 11, -1)
+	archived := email("Archive", 5, 13)
+	emails := append([]*EmailMessage{inboxFailed, archived}, inboxRecorded...)
+	recorded := append([]*EmailMessage{archived}, inboxRecorded...)
+	if err := saveRecordedUIDs(config, emails, recorded); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := loadUIDStates(config.UIDStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := states["INBOX"].LastUID; got != 10 {
+		t.Errorf("INBOX last UID = %d, want 10, below the failed UID 11", got)
+	}
+	if got := states["Archive"].LastUID; got != 5 {
+		t.Errorf("Archive last UID = %d, want 5", got)
+	}
+}
@@ -0,0 +1,123 @@
+// Correct the saves count recorded for a date, in place, e.g. after it was
+// extracted wrongly.
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Return the config of the named property, or the only one. A name is
+// required when properties are configured.
+func selectProperty(config *Config, name string) (*Config, error) {
+	var names []string
+	for _, c := range propertyConfigs(config) {
+		if c.PropertyName == name {
+			return c, nil
+		}
+		names = append(names, c.PropertyName)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("-property is required (properties: %s)", strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("no property named %q (properties: %s)", name, strings.Join(names, ", "))
+}
+
+// Find the row for date in the property's sheet and overwrite its saves
+// count with count. If the date isn't in the sheet, report it, or with
+// appendMissing, append a row for it instead.
+func updateSavesCount(ctx context.Context, config *Config, date time.Time, count int, appendMissing bool) error {
+	if config.xlsxOutput() {
+		return fmt.Errorf("update writes only to Google Sheets, not with output_mode \"xlsx\"")
+	}
+	srv, err := newSheetsService(ctx, config)
+	if err != nil {
+		return err
+	}
+	return updateSavesCell(ctx, srv, config, date, count, appendMissing)
+}
+
+// Overwrite the saves count for date as updateSavesCount does, using srv.
+// Only the saves cell is written, so the rest of the row is kept.
+func updateSavesCell(ctx context.Context, srv *sheets.Service, config *Config, date time.Time, count int, appendMissing bool) error {
+	config, err := withSheetRange(ctx, srv, config)
+	if err != nil {
+		return err
+	}
+	rows, err := getSheetData(ctx, srv, config.sheetsRetry(), config.SpreadsheetID, config.Range)
+	if err != nil {
+		return err
+	}
+
+	sheetName, startColumn, startRow := splitA1Range(config.Range)
+	dateIndex := metricColumnIndex(config, "date")
+	savesIndex := metricColumnIndex(config, "saves")
+	if dateIndex < 0 || savesIndex < 0 {
+		return fmt.Errorf("the date and saves columns must both be recorded to update a row")
+	}
+	if config.isPreservedColumn(startColumn + savesIndex) {
+		return fmt.Errorf("the saves column %s is in preserve_columns", columnLetter(startColumn+savesIndex))
+	}
+	prefix := ""
+	if sheetName != "" {
+		prefix = sheetName + "!"
+	}
+
+	day := date.Format(dateFormat)
+	var matches []int
+	for i, row := range rows {
+		if dateIndex >= len(row) {
+			continue
+		}
+		rowDate, err := parseSheetDate(strings.TrimSpace(fmt.Sprintf("%v", row[dateIndex])), config.sheetDateFormat())
+		if err == nil && rowDate.Format(dateFormat) == day {
+			matches = append(matches, i)
+		}
+	}
+
+	if len(matches) == 0 {
+		if !appendMissing {
+			return fmt.Errorf("no row for %s in the sheet (use -append to add one)", day)
+		}
+		fmt.Printf("No row for %s in the sheet; appending one\n", day)
+		emails := []*EmailMessage{{ID: "update", Date: date, ZillowSaves: count}}
+		if len(config.Columns) > 0 {
+			_, err = writeToColumns(ctx, srv, config, len(rows), emails)
+		} else {
+			_, err = appendToSheet(ctx, srv, config, emails)
+			err = handleDailyQuotaError(config, err)
+		}
+		if err == nil {
+			logEvent("row_appended", "property", config.PropertyName, "date", day, "saves", count)
+		}
+		return err
+	}
+	if len(matches) > 1 {
+		fmt.Printf("Warning: %d rows for %s in the sheet; updating the first\n", len(matches), day)
+	}
+
+	row := rows[matches[0]]
+	var old interface{} = ""
+	if savesIndex < len(row) {
+		old = row[savesIndex]
+	}
+	cell := fmt.Sprintf("%s%s%d", prefix, columnLetter(startColumn+savesIndex), startRow+matches[0])
+	valueRange := &sheets.ValueRange{Values: [][]interface{}{{count}}}
+	err = withSheetsRetry(ctx, config.sheetsRetry(), "update", func() error {
+		_, err := srv.Spreadsheets.Values.Update(config.SpreadsheetID, cell, valueRange).
+			ValueInputOption(config.valueInputOption()).
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update %s: %v", cell, err)
+	}
+	logEvent("row_updated", "property", config.PropertyName, "date", day, "cell", cell, "old", old, "saves", count)
+	fmt.Printf("Updated the saves count for %s in %s from %v to %d\n", day, cell, old, count)
+	return nil
+}
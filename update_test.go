@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A note kept by hand in a preserved column survives correcting the row's
+// saves count and appending the next day's row.
+func TestPreservedNoteSurvivesWrite(t *testing.T) {
+	fake, srv := startFakeSheets(t, map[string][][]string{"sheet": {
+		{"Date", "Saves", "Contacts", "Price/sqft", "Note"},
+		{"2025-08-01", "12", "2", "215", "open house"},
+	}})
+	config := &Config{
+		SpreadsheetID:   "sheet",
+		Range:           "Sheet1!A:E",
+		PreserveColumns: []string{"E"},
+		SheetsRetries:   -1,
+	}
+
+	ctx := context.Background()
+	if err := updateSavesCell(ctx, srv, config, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 15, false); err != nil {
+		t.Fatalf("updateSavesCell: %v", err)
+	}
+	email := &EmailMessage{ID: "2", Date: time.Date(2025, 8, 2, 7, 0, 0, 0, time.UTC), ZillowSaves: 14, Contacts: 3, PricePerSqFt: 215}
+	if _, err := appendToSheet(ctx, srv, config, []*EmailMessage{email}); err != nil {
+		t.Fatalf("appendToSheet: %v", err)
+	}
+
+	want := [][]string{
+		{"Date", "Saves", "Contacts", "Price/sqft", "Note"},
+		{"2025-08-01", "15", "2", "215", "open house"},
+		{"2025-08-02", "14", "3", "215"},
+	}
+	if got := fake.rows("sheet"); !reflect.DeepEqual(got, want) {
+		t.Errorf("sheet after writes = %q, want %q", got, want)
+	}
+}
+
+// A preserved column must not be one in which a metric is recorded.
+func TestValidatePreserveColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"after the data", Config{Range: "Sheet1!A:Z", PreserveColumns: []string{"F"}}, false},
+		{"lower case", Config{Range: "Sheet1!A:Z", PreserveColumns: []string{"f"}}, false},
+		{"contacts column", Config{Range: "Sheet1!A:Z", PreserveColumns: []string{"C"}}, true},
+		{"contacts by number", Config{Range: "Sheet1!A:Z", PreserveColumns: []string{"3"}}, true},
+		{"range starting at B", Config{Range: "Sheet1!B:Z", PreserveColumns: []string{"E"}}, true},
+		{"before the range", Config{Range: "Sheet1!B:Z", PreserveColumns: []string{"A"}}, false},
+		{"mapped column", Config{Range: "Sheet1!A:Z", Columns: map[string]string{"date": "A", "saves": "D"}, PreserveColumns: []string{"D"}}, true},
+		{"unmapped column", Config{Range: "Sheet1!A:Z", Columns: map[string]string{"date": "A", "saves": "D"}, PreserveColumns: []string{"B"}}, false},
+		{"a cell", Config{Range: "Sheet1!A:Z", PreserveColumns: []string{"F1"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.validatePreserveColumns(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validatePreserveColumns() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Check the configuration up front, so that a missing or malformed field is
+// reported clearly rather than surfacing later as an IMAP or Sheets error.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/riordanmr/zillowsaves/zillow"
+)
+
+// An A1 range, optionally prefixed by a sheet name, e.g. "Sheet1!A:Z",
+// "'My Sheet'!B2:E", or "A1:D".
+var a1RangeRegex = regexp.MustCompile(`^(('[^']+'|[^!':]+)!)?[A-Za-z]{1,3}\d*(:[A-Za-z]{1,3}\d*)?$`)
+
+// Check the fields needed to fetch emails and record their data, for the
+// top-level config and each property. Returns an error listing every
+// problem found.
+func validateConfig(config *Config) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, c := range accountConfigs(config) {
+		where := ""
+		if c.AccountName != "" {
+			where = fmt.Sprintf(" for account %q", c.AccountName)
+		}
+		if c.YahooUsername == "" {
+			add("yahoo_username is required%s", where)
+		}
+		if _, ok := imapProviders[c.Provider]; c.Provider != "" && !ok {
+			add("provider %q%s is not \"yahoo\", \"gmail\", or \"outlook\"", c.Provider, where)
+		}
+		methods := c.imapAuthMethods()
+		if c.YahooAppPassword == "" && usesAppPassword(methods) {
+			add("yahoo_app_password is required%s (or set auth_method to \"oauth2\")", where)
+		}
+		for _, method := range methods {
+			if method != zillow.AuthMethodAppPassword && method != zillow.AuthMethodOAuth2 {
+				add("auth method %q%s is not \"app_password\" or \"oauth2\"", method, where)
+			}
+		}
+		if usesOAuth2(methods) && c.IMAPOAuthTokenFile == "" && c.IMAPOAuthCredentialsFile == "" {
+			add("imap_oauth_token_file or imap_oauth_credentials_file is required%s for the oauth2 auth method", where)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, a := range config.Accounts {
+		if a.Name == "" {
+			add("each of accounts needs a name")
+		} else if seen[a.Name] {
+			add("account name %q is used more than once", a.Name)
+		}
+		seen[a.Name] = true
+	}
+
+	if config.xlsxOutput() {
+		if config.XLSXPath == "" {
+			add("xlsx_path is required with output_mode \"xlsx\"")
+		}
+	} else if config.OutputMode != "" && config.OutputMode != "sheets" {
+		add("output_mode %q is not \"sheets\" or \"xlsx\"", config.OutputMode)
+	} else {
+		for _, c := range propertyConfigs(config) {
+			where := ""
+			if c.PropertyName != "" {
+				where = fmt.Sprintf(" for property %q", c.PropertyName)
+			}
+			if c.SpreadsheetID == "" {
+				add("spreadsheet_id is required%s", where)
+			}
+			if c.Range == "" && c.SheetName == "" {
+				add("range or sheet_name is required%s", where)
+			} else if c.SheetName == "" && !a1RangeRegex.MatchString(c.Range) {
+				add("range %q%s is not a valid A1 range, e.g. \"Sheet1!A:Z\"", c.Range, where)
+			}
+		}
+		if err := validateColumns(config.Columns); err != nil {
+			add("%v", err)
+		}
+	}
+
+	for _, c := range propertyConfigs(config) {
+		if _, err := time.Parse(dateFormat, c.StartDate); c.StartDate != "" && err != nil {
+			add("start_date %q is not a YYYY-MM-DD date", c.StartDate)
+		}
+		if _, err := time.Parse(dateFormat, c.ListingStartDate); c.ListingStartDate != "" && err != nil {
+			add("listing_start_date %q is not a YYYY-MM-DD date", c.ListingStartDate)
+		}
+		if c.DateFormat != "" && !isDateLayout(c.DateFormat) {
+			add("date_format %q is not a Go date layout with a year, month, and day, e.g. \"1/2/2006\"", c.DateFormat)
+		}
+		if err := c.validatePreserveColumns(); err != nil {
+			where := ""
+			if c.PropertyName != "" {
+				where = fmt.Sprintf(" (property %q)", c.PropertyName)
+			}
+			add("%v%s", err, where)
+		}
+	}
+	if config.DateSource != "" && config.DateSource != "report" && config.DateSource != "envelope" {
+		add("date_source %q is not \"report\" or \"envelope\"", config.DateSource)
+	}
+	if _, err := config.imapTLSConfig(); err != nil {
+		add("%v", err)
+	}
+	if config.AmbiguousSaves != "" && config.AmbiguousSaves != "record" && config.AmbiguousSaves != "skip" {
+		add("ambiguous_saves %q is not \"record\" or \"skip\"", config.AmbiguousSaves)
+	}
+	if config.ValueInputOption != "" && config.ValueInputOption != "RAW" && config.ValueInputOption != "USER_ENTERED" {
+		add("value_input_option %q is not \"RAW\" or \"USER_ENTERED\"", config.ValueInputOption)
+	}
+	if err := zillow.ValidatePatterns(config.SavesPatterns); err != nil {
+		add("saves_patterns: %v", err)
+	}
+	for _, format := range config.ReportFormats {
+		if err := format.Validate(); err != nil {
+			add("report_formats: %v", err)
+		}
+	}
+
+	for _, p := range config.Properties {
+		if p.Name == "" {
+			add("each of properties needs a name")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// Report whether the app password may be used to log in to IMAP.
+func usesAppPassword(methods []string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, method := range methods {
+		if method == zillow.AuthMethodAppPassword {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether the given IMAP auth methods include oauth2.
+func usesOAuth2(methods []string) bool {
+	for _, method := range methods {
+		if method == zillow.AuthMethodOAuth2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether layout writes dates that read back as the same day, i.e.
+// that it is a Go layout (not e.g. "MM/DD/YYYY") with a year, month and day.
+func isDateLayout(layout string) bool {
+	day := time.Date(2025, time.August, 14, 0, 0, 0, 0, time.UTC)
+	parsed, err := time.Parse(layout, day.Format(layout))
+	return err == nil && parsed.Format(dateFormat) == day.Format(dateFormat)
+}
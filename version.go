@@ -0,0 +1,17 @@
+// Build metadata, set at build time via -ldflags, e.g.:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+package main
+
+import "fmt"
+
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// Return a one-line description of this build.
+func versionString() string {
+	return fmt.Sprintf("zillowsaves %s (commit %s, built %s)", version, commit, buildDate)
+}
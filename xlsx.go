@@ -0,0 +1,155 @@
+// Excel (.xlsx) output, for output_mode "xlsx": rows are appended to a
+// worksheet in a local workbook instead of a Google Sheet.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const defaultXLSXSheet = "Sheet1"
+
+// Headings for the header row written to a new worksheet.
+var xlsxHeadings = map[string]string{
+	"date":           "Date",
+	"saves":          "Saves",
+	"contacts":       "Contacts",
+	"price_per_sqft": "Price/sqft",
+	"shares":         "Shares",
+	"address":        "Address",
+	"received_date":  "Received",
+	"subject":        "Subject",
+}
+
+// Report whether rows are written to an Excel workbook.
+func (c *Config) xlsxOutput() bool {
+	return c.OutputMode == "xlsx"
+}
+
+func (c *Config) xlsxSheet() string {
+	if c.XLSXSheet != "" {
+		return c.XLSXSheet
+	}
+	return defaultXLSXSheet
+}
+
+// Return an error if Excel's lock file shows the workbook is open, since
+// Excel would overwrite our changes (or refuse them) when it saves.
+func checkXLSXNotOpen(path string) error {
+	lockFile := filepath.Join(filepath.Dir(path), "~$"+filepath.Base(path))
+	if _, err := os.Stat(lockFile); err == nil {
+		return fmt.Errorf("%s appears to be open in Excel (lock file %s exists); close it and run again", path, lockFile)
+	}
+	return nil
+}
+
+// Read the rows of the worksheet, in the same form as getSheetData. A
+// missing workbook or worksheet has no rows.
+func getXLSXData(path, sheet string) ([][]interface{}, error) {
+	f, err := excelize.OpenFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if index, err := f.GetSheetIndex(sheet); err != nil || index < 0 {
+		return nil, nil
+	}
+	cells, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read worksheet %s of %s: %v", sheet, path, err)
+	}
+	rows := make([][]interface{}, len(cells))
+	for i, row := range cells {
+		rows[i] = make([]interface{}, len(row))
+		for j, cell := range row {
+			rows[i][j] = cell
+		}
+	}
+	return rows, nil
+}
+
+// Append Zillow saves data to the worksheet, creating the workbook and
+// worksheet, with a header row, if they don't exist. Existing rows are kept.
+func appendToXLSX(config *Config, emails []*EmailMessage) (writeResult, error) {
+	values := sheetRows(config, emails)
+	if len(values) == 0 {
+		fmt.Println("No email data to append to workbook")
+		return writeResult{}, nil
+	}
+	path := config.XLSXPath
+	if path == "" {
+		return writeResult{}, fmt.Errorf("output_mode xlsx requires xlsx_path")
+	}
+	if err := checkXLSXNotOpen(path); err != nil {
+		return writeResult{}, err
+	}
+
+	f, err := excelize.OpenFile(path)
+	if os.IsNotExist(err) {
+		f = excelize.NewFile()
+		// Rename the default worksheet rather than leaving it empty.
+		if err := f.SetSheetName(defaultXLSXSheet, config.xlsxSheet()); err != nil {
+			return writeResult{}, err
+		}
+	} else if err != nil {
+		return writeResult{}, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	sheet := config.xlsxSheet()
+	if index, err := f.GetSheetIndex(sheet); err != nil || index < 0 {
+		if _, err := f.NewSheet(sheet); err != nil {
+			return writeResult{}, fmt.Errorf("unable to create worksheet %s: %v", sheet, err)
+		}
+	}
+	existing, err := f.GetRows(sheet)
+	if err != nil {
+		return writeResult{}, fmt.Errorf("unable to read worksheet %s of %s: %v", sheet, path, err)
+	}
+	next := len(existing) + 1
+	if len(existing) == 0 {
+		var header []interface{}
+		for _, name := range config.recordedMetrics() {
+			header = append(header, xlsxHeadings[name])
+		}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return writeResult{}, err
+		}
+		next = 2
+	}
+
+	first := next
+	for _, row := range values {
+		cell, err := excelize.CoordinatesToCellName(1, next)
+		if err != nil {
+			return writeResult{}, err
+		}
+		row := row
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return writeResult{}, fmt.Errorf("unable to write row %d of worksheet %s: %v", next, sheet, err)
+		}
+		next++
+	}
+
+	if err := f.SaveAs(path); err != nil {
+		return writeResult{}, fmt.Errorf("unable to save %s (is it open in another program?): %v", path, err)
+	}
+	lastColumn, err := excelize.ColumnNumberToName(len(config.recordedMetrics()))
+	if err != nil {
+		return writeResult{}, err
+	}
+	result := writeResult{
+		UpdatedRange: fmt.Sprintf("%s!A%d:%s%d", sheet, first, lastColumn, next-1),
+		UpdatedRows:  int64(len(values)),
+		UpdatedCells: int64(len(values) * len(config.recordedMetrics())),
+	}
+	fmt.Printf("Successfully appended %d rows to %s (%s)\n", result.UpdatedRows, path, result.UpdatedRange)
+	return result, nil
+}
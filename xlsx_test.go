@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Rows appended to a new workbook, and then to the same one, read back as
+// written, under a header row.
+func TestXLSXRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "saves.xlsx")
+	config := &Config{OutputMode: "xlsx", XLSXPath: path, XLSXSheet: "Saves"}
+	email := func(day, saves int) *EmailMessage {
+		return &EmailMessage{Date: time.Date(2025, 8, day, 7, 0, 0, 0, time.UTC), ZillowSaves: saves, Contacts: 2, PricePerSqFt: 215}
+	}
+
+	if _, err := appendToXLSX(config, []*EmailMessage{email(1, 12), email(2, 13)}); err != nil {
+		t.Fatalf("appending to a new workbook: %v", err)
+	}
+	result, err := appendToXLSX(config, []*EmailMessage{email(3, 14)})
+	if err != nil {
+		t.Fatalf("appending to the workbook again: %v", err)
+	}
+	if want := "Saves!A4:D4"; result.UpdatedRange != want {
+		t.Errorf("second append wrote %s, want %s", result.UpdatedRange, want)
+	}
+
+	rows, err := getXLSXData(path, config.xlsxSheet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{
+		{"Date", "Saves", "Contacts", "Price/sqft"},
+		{"2025-08-01", "12", "2", "215"},
+		{"2025-08-02", "13", "2", "215"},
+		{"2025-08-03", "14", "2", "215"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("workbook rows = %v, want %v", rows, want)
+	}
+	if dates := recordedDates(config, rows); len(dates) != 3 || !dates["2025-08-03"] {
+		t.Errorf("recordedDates of the workbook rows = %v, want the 3 appended dates", dates)
+	}
+}
+
+// A workbook open in Excel isn't written.
+func TestXLSXOpenInExcel(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{OutputMode: "xlsx", XLSXPath: filepath.Join(dir, "saves.xlsx")}
+	if err := os.WriteFile(filepath.Join(dir, "~$saves.xlsx"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := appendToXLSX(config, []*EmailMessage{{Date: time.Date(2025, 8, 1, 7, 0, 0, 0, time.UTC)}})
+	if err == nil || !strings.Contains(err.Error(), "open in Excel") {
+		t.Errorf("appending to an open workbook returned %v, want an error saying it is open in Excel", err)
+	}
+	if _, err := os.Stat(config.XLSXPath); !os.IsNotExist(err) {
+		t.Errorf("the workbook was written while open in Excel")
+	}
+}
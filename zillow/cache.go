@@ -0,0 +1,67 @@
+// Cache fetched emails on disk, so that repeated runs over the same window,
+// e.g. while working on extraction, only download emails not fetched before.
+package zillow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cachedEmail is the part of an Email that is fetched from IMAP.
+type cachedEmail struct {
+	Subject      string    `json:"subject"`
+	Date         time.Time `json:"date"`
+	ReceivedDate time.Time `json:"received_date"`
+	MessageID    string    `json:"message_id"`
+	Content      string    `json:"content"`
+}
+
+// Return the cache file for a message. UIDs are only unique within a mailbox
+// and its UIDVALIDITY, so both are part of the path.
+func emailCachePath(dir, mailbox string, uidValidity, uid uint32) string {
+	return filepath.Join(dir, url.PathEscape(mailbox), fmt.Sprintf("%d-%d.json", uidValidity, uid))
+}
+
+// Load the cached email with the given UID, which is its ID as for a
+// fetched email.
+func loadCachedEmail(path string, uid uint32) (*Email, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cached cachedEmail
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return &Email{
+		Subject:      cached.Subject,
+		Date:         cached.Date,
+		ReceivedDate: cached.ReceivedDate,
+		ID:           fmt.Sprintf("%d", uid),
+		MessageID:    cached.MessageID,
+		Content:      cached.Content,
+	}, nil
+}
+
+// Save a fetched email to the cache.
+func saveCachedEmail(path string, email *Email) error {
+	data, err := json.Marshal(cachedEmail{
+		Subject:      email.Subject,
+		Date:         email.Date,
+		ReceivedDate: email.ReceivedDate,
+		MessageID:    email.MessageID,
+		Content:      email.Content,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,283 @@
+// Extract the figures from the text of a report email.
+package zillow
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counts that reports give in words, e.g. "no new saves" or "saved once",
+// which a pattern may capture in place of a number.
+var countWords = map[string]int{
+	"no":    0,
+	"none":  0,
+	"zero":  0,
+	"once":  1,
+	"one":   1,
+	"twice": 2,
+	"two":   2,
+}
+
+// Parse a captured count: a number, ignoring any thousands separators, or
+// one of countWords.
+func parseCount(s string) (int, error) {
+	if count, ok := countWords[s]; ok {
+		return count, nil
+	}
+	return strconv.Atoi(strings.ReplaceAll(s, ",", ""))
+}
+
+// Each pattern compiled so far, so that one is compiled only once rather than
+// for every email.
+var compiledPatterns sync.Map
+
+// Return the compiled pattern, which must be valid (see ValidatePatterns).
+func compilePattern(pattern string) *regexp.Regexp {
+	if re, ok := compiledPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	compiledPatterns.Store(pattern, re)
+	return re
+}
+
+// Search lower-cased content for the first pattern that matches, and return
+// the number captured by its first group, ignoring any thousands separators.
+// found is false if nothing matched.
+func FindCount(content string, patterns []string) (count int, found bool) {
+	lowerContent := strings.ToLower(content)
+
+	for _, pattern := range patterns {
+		re := compilePattern(pattern)
+		matches := re.FindStringSubmatch(lowerContent)
+		if len(matches) > 1 {
+			if count, err := parseCount(matches[1]); err == nil {
+				return count, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// Returned when an email contains no saves count.
+var ErrNoSavesCount = errors.New("no saves count found in email")
+
+// A number matched by a pattern, with the line it appears on and the text
+// around it.
+type countMatch struct {
+	count   int
+	line    string
+	pattern string
+	snippet string
+}
+
+// How many characters either side of a match to include in its snippet.
+const snippetContext = 30
+
+// Return the text around content[start:end], on one line.
+func snippetAround(content string, start, end int) string {
+	from, to := start-snippetContext, end+snippetContext
+	if from < 0 {
+		from = 0
+	}
+	if to > len(content) {
+		to = len(content)
+	}
+	return strings.Join(strings.Fields(content[from:to]), " ")
+}
+
+// Like FindCount, but return every number matched by any of the patterns,
+// in the order they appear in the content.
+func findAllCounts(content string, patterns []string) []countMatch {
+	lowerContent := strings.ToLower(content)
+
+	type located struct {
+		at int
+		countMatch
+	}
+	var all []located
+	for _, pattern := range patterns {
+		re := compilePattern(pattern)
+		for _, loc := range re.FindAllStringSubmatchIndex(lowerContent, -1) {
+			if len(loc) < 4 || loc[2] < 0 {
+				continue
+			}
+			count, err := parseCount(lowerContent[loc[2]:loc[3]])
+			if err != nil {
+				continue
+			}
+			start := strings.LastIndex(lowerContent[:loc[0]], "\n") + 1
+			end := len(lowerContent)
+			if i := strings.Index(lowerContent[loc[1]:], "\n"); i >= 0 {
+				end = loc[1] + i
+			}
+			all = append(all, located{loc[0], countMatch{
+				count:   count,
+				line:    lowerContent[start:end],
+				pattern: pattern,
+				snippet: snippetAround(lowerContent, loc[0], loc[1]),
+			}})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].at < all[j].at })
+	matches := make([]countMatch, len(all))
+	for i, m := range all {
+		matches[i] = m.countMatch
+	}
+	return matches
+}
+
+// Keywords on the line of a saves figure that identify which figure it is,
+// for the saves_figure setting.
+var savesFigureKeywords = map[string][]string{
+	"total":  {"total", "all time", "all-time", "since listing", "so far"},
+	"period": {"this week", "today", "yesterday", "past", "last"},
+}
+
+// SavesMatch is the saves count found in an email, with where it was found.
+type SavesMatch struct {
+	Count   int
+	Pattern string // The saves pattern that matched it.
+	Snippet string // The lower-cased text around it.
+	// Another pattern matched a different number, and figure did not pick
+	// between them, so the count may be wrong (e.g. a digit of a ZIP code).
+	Ambiguous bool
+	Conflicts []SavesMatch // The other patterns' differing matches.
+}
+
+// Return the format, or DefaultReportFormat if it is nil.
+func formatOrDefault(format *ReportFormat) *ReportFormat {
+	if format == nil {
+		return &DefaultReportFormat
+	}
+	return format
+}
+
+// Given an email body in the given format, or DefaultReportFormat if it is
+// nil, extract the Zillow saves count.
+// When the email gives more than one saves figure, figure selects which to
+// use: "total" or "period" for the figure on a line with the corresponding
+// keywords, or another word or phrase to look for on its line. An empty
+// figure, or one found on no line, uses the first.
+func ExtractZillowSavesCount(content string, format *ReportFormat, figure string) (int, error) {
+	match, err := ExtractZillowSavesMatch(content, format, figure)
+	return match.Count, err
+}
+
+// Like ExtractZillowSavesCount, but also return which pattern matched, the
+// text around the number, and whether the match is ambiguous.
+func ExtractZillowSavesMatch(content string, format *ReportFormat, figure string) (SavesMatch, error) {
+	matches := findAllCounts(content, formatOrDefault(format).SavesPatterns)
+	if len(matches) == 0 {
+		return SavesMatch{}, ErrNoSavesCount
+	}
+	var counts []string
+	distinct := make(map[int]bool)
+	for _, m := range matches {
+		counts = append(counts, strconv.Itoa(m.count))
+		distinct[m.count] = true
+	}
+	if len(distinct) == 1 {
+		return savesMatch(matches, matches[0], false), nil
+	}
+	if figure == "" {
+		printf("  Warning: found %d saves figures (%s); using the first. Set saves_figure to choose another.\n",
+			len(matches), strings.Join(counts, ", "))
+		return savesMatch(matches, matches[0], true), nil
+	}
+	keywords, ok := savesFigureKeywords[figure]
+	if !ok {
+		keywords = []string{strings.ToLower(figure)}
+	}
+	for _, m := range matches {
+		for _, keyword := range keywords {
+			if strings.Contains(m.line, keyword) {
+				return savesMatch(matches, m, false), nil
+			}
+		}
+	}
+	printf("  Warning: none of the saves figures (%s) is marked as saves_figure %q; using the first\n",
+		strings.Join(counts, ", "), figure)
+	return savesMatch(matches, matches[0], true), nil
+}
+
+// Describe the chosen match. Unless figure picked it, it is ambiguous if
+// another pattern matched a different number.
+func savesMatch(matches []countMatch, chosen countMatch, unpicked bool) SavesMatch {
+	match := SavesMatch{Count: chosen.count, Pattern: chosen.pattern, Snippet: chosen.snippet}
+	if !unpicked {
+		return match
+	}
+	for _, m := range matches {
+		if m.pattern != chosen.pattern && m.count != chosen.count {
+			match.Conflicts = append(match.Conflicts, SavesMatch{Count: m.count, Pattern: m.pattern, Snippet: m.snippet})
+		}
+	}
+	match.Ambiguous = len(match.Conflicts) > 0
+	return match
+}
+
+// Given an email body in the given format (nil for the default), extract the
+// number of contacts/inquiries from buyers.
+// found is false if the report does not include this figure.
+func ExtractContactsCount(content string, format *ReportFormat) (count int, found bool) {
+	return FindCount(content, formatOrDefault(format).ContactsPatterns)
+}
+
+// Given an email body in the given format (nil for the default), extract the
+// number of shares.
+// found is false if the report does not include this figure.
+func ExtractSharesCount(content string, format *ReportFormat) (count int, found bool) {
+	return FindCount(content, formatOrDefault(format).SharesPatterns)
+}
+
+// Given an email body in the given format (nil for the default), extract the
+// price per square foot in dollars.
+// found is false if the report does not include this figure.
+func ExtractPricePerSqFt(content string, format *ReportFormat) (price int, found bool) {
+	return FindCount(content, formatOrDefault(format).PricePatterns)
+}
+
+// Patterns for the property address, tried in order. The last matches the
+// subject header, which is included in the content of a fetched email.
+var propertyAddressRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)your\s+listing\s+at\s+(.+?)\s+did\b`),
+	regexp.MustCompile(`(?im)listing\s+summary\s+for\s+(.+?)\s*$`),
+	regexp.MustCompile(`(?im)^subject:\s*your\s+daily\s+listing\s+report:\s*(.+?)\s*$`),
+}
+
+// Given an email body, extract the street address of the listing, e.g.
+// "9121 Blackhawk Rd".
+func ExtractPropertyAddress(content string) (string, error) {
+	for _, re := range propertyAddressRegexes {
+		if matches := re.FindStringSubmatch(content); matches != nil {
+			return matches[1], nil
+		}
+	}
+	return "", fmt.Errorf("no property address found")
+}
+
+var reportDateRegex = regexp.MustCompile(`(?i)report\s+for\s+([a-z]+\.?\s+\d{1,2},\s*\d{4})`)
+
+// Given an email body, extract the date the report covers, e.g. from
+// "Report for August 30, 2025".
+func ExtractReportDate(content string) (time.Time, error) {
+	matches := reportDateRegex.FindStringSubmatch(content)
+	if matches == nil {
+		return time.Time{}, fmt.Errorf("no report date found")
+	}
+	dateStr := strings.Join(strings.Fields(strings.Replace(matches[1], ".", "", 1)), " ")
+	for _, format := range []string{"January 2, 2006", "Jan 2, 2006", "January 2,2006", "Jan 2,2006"} {
+		if date, err := time.Parse(format, dateStr); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized report date %q", matches[1])
+}
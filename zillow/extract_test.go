@@ -0,0 +1,93 @@
+package zillow
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExtractZillowSavesCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr error
+	}{
+		{"plain", "Your listing had 151 views and 12 saves yesterday.", 12, nil},
+		{"singular", "Your listing had 40 views and 1 save yesterday.", 1, nil},
+		{"zero", "Your listing had 35 views and 0 saves yesterday.", 0, nil},
+		{"capitalized", "12 Saves", 12, nil},
+		{"thousands separator", "Your listing has 1,234 saves so far.", 1234, nil},
+		{"lower bound", "Your listing has 1,000+ saves.", 1000, nil},
+		// A report with no saves count is an error, not zero saves.
+		{"no match", "Your listing had 151 views yesterday.", 0, ErrNoSavesCount},
+		{"empty", "", 0, ErrNoSavesCount},
+		{"html", stripHTML(`<html><body>
+<p>Here&#39;s how your listing at 9121 Blackhawk Rd did yesterday.</p>
+<table><tr><td class="stat">151</td><td class="label">views</td></tr>
+<tr><td class="stat">14</td><td class="label">saves</td></tr>
+<tr><td class="stat">3</td><td class="label">contacts</td></tr></table>
+<p>Listed at $449,900 ($215/sqft).</p>
+</body></html>`), 14, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractZillowSavesCount(tt.content, &DefaultReportFormat, "")
+			if err != tt.wantErr {
+				t.Fatalf("ExtractZillowSavesCount(%q) error = %v, want %v", tt.content, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractZillowSavesCount(%q) = %d, want %d", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// Counts given in words are read from the report's own lines, and not from
+// other text that happens to use the words.
+func TestExtractZillowSavesWords(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr error
+	}{
+		{"no new saves", "98 views\n  No new saves\nListed at $449,900", 0, nil},
+		{"saved once", "98 views\n  Saved once\nListed at $449,900", 1, nil},
+		{"saved twice", "98 views\nSaved twice\n", 2, nil},
+		{"singular", "98 views\n1 save\n", 1, nil},
+		{"tip", "12 saves. Tip: homes with no saves get fewer views.", 12, nil},
+		{"tip on its own line", "12 saves\nTip: homes with no new saves get fewer views.", 12, nil},
+		{"mid-sentence", "Your listing was saved once by a buyer.", 0, ErrNoSavesCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := ExtractZillowSavesMatch(tt.content, &DefaultReportFormat, "")
+			if err != tt.wantErr {
+				t.Fatalf("ExtractZillowSavesMatch(%q) error = %v, want %v", tt.content, err, tt.wantErr)
+			}
+			if match.Count != tt.want {
+				t.Errorf("ExtractZillowSavesMatch(%q) = %d, want %d", tt.content, match.Count, tt.want)
+			}
+			if match.Ambiguous {
+				t.Errorf("ExtractZillowSavesMatch(%q) is ambiguous, with conflicts %+v", tt.content, match.Conflicts)
+			}
+		})
+	}
+}
+
+// A nil format is the default one, and a warning about the choice of figure
+// is written to Output.
+func TestExtractZillowSavesNilFormat(t *testing.T) {
+	var out strings.Builder
+	Output = &out
+	defer func() { Output = io.Discard }()
+
+	got, err := ExtractZillowSavesCount("12 saves this week\n340 saves so far", nil, "")
+	if err != nil || got != 12 {
+		t.Errorf("ExtractZillowSavesCount with a nil format = %d, %v, want 12", got, err)
+	}
+	if !strings.Contains(out.String(), "found 2 saves figures") {
+		t.Errorf("Output = %q, want the warning about two figures", out.String())
+	}
+}
@@ -0,0 +1,117 @@
+// Zillow has changed the layout of its report emails over time. Each layout
+// is described by a ReportFormat, and the format of each email is detected
+// from a marker phrase in its body and/or its date.
+package zillow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ReportFormat describes one layout of the Zillow report email.
+type ReportFormat struct {
+	Name string `json:"name"`
+	// An email is in this format if its body contains Marker (ignoring case)
+	// and it is dated on or after From and before Until (YYYY-MM-DD).
+	// Empty fields match any email.
+	Marker string `json:"marker"`
+	From   string `json:"from"`
+	Until  string `json:"until"`
+	// Regular expressions whose first group is the figure. Empty lists use
+	// the patterns of the default format.
+	SavesPatterns    []string `json:"saves_patterns"`
+	ContactsPatterns []string `json:"contacts_patterns"`
+	PricePatterns    []string `json:"price_per_sqft_patterns"`
+	SharesPatterns   []string `json:"shares_patterns"`
+}
+
+// The current daily listing report, used for emails matching no other format.
+var DefaultReportFormat = ReportFormat{
+	Name: "daily",
+	SavesPatterns: []string{
+		// Also matches "over 1,000 saves" and "1,000+ saves".
+		`(\d[\d,]*)\+?\s+saves?`,
+		// Counts given in words (see countWords), only at the start of a
+		// line as the report puts them, so that tips like "homes with no
+		// saves get fewer views" aren't read as counts.
+		`(?m)^\s*(no)\s+new\s+saves?\b`,
+		`(?m)^\s*saved\s+(once|twice)\b`,
+		// `saved\s+(\d+)\s+times?`,
+		// `(\d+)\s+people?\s+saved`,
+		// `total\s+saves?:\s*(\d+)`,
+		// `save\s+count:\s*(\d+)`,
+		// `(\d+)\s+favorites?`,
+		// `favorited\s+(\d+)\s+times?`,
+	},
+	ContactsPatterns: []string{
+		`(\d[\d,]*)\+?\s+(?:contacts?|inquir(?:y|ies))`,
+	},
+	PricePatterns: []string{
+		`\$([\d,]+)\s*/\s*sq\s*\.?\s*ft`,
+	},
+	SharesPatterns: []string{
+		`(\d[\d,]*)\+?\s+shares?`,
+	},
+}
+
+// Built-in formats other than the default, checked in order.
+var BuiltinReportFormats = []ReportFormat{
+	{
+		// The earlier "Listing summary" layout, with one "Label: value" per line.
+		Name:             "summary",
+		Marker:           "Listing summary",
+		SavesPatterns:    []string{`saves:\s*(\d[\d,]*)`},
+		ContactsPatterns: []string{`contacts:\s*(\d[\d,]*)`},
+		PricePatterns:    []string{`price\s+per\s+sq\.?\s*ft:\s*\$([\d,]+)`},
+		SharesPatterns:   []string{`shares:\s*(\d[\d,]*)`},
+	},
+}
+
+// Validate checks that the format's dates and patterns are valid.
+func (f *ReportFormat) Validate() error {
+	for _, date := range []string{f.From, f.Until} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(dateFormat, date); err != nil {
+			return fmt.Errorf("invalid date %q in report format %q: %v", date, f.Name, err)
+		}
+	}
+	for _, patterns := range [][]string{f.SavesPatterns, f.ContactsPatterns, f.PricePatterns, f.SharesPatterns} {
+		if err := ValidatePatterns(patterns); err != nil {
+			return fmt.Errorf("%v in report format %q", err, f.Name)
+		}
+	}
+	return nil
+}
+
+// Check that each pattern compiles and has a group to capture the figure.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		if re.NumSubexp() == 0 {
+			return fmt.Errorf("pattern %q has no group to capture the figure", pattern)
+		}
+	}
+	return nil
+}
+
+// Report whether an email with the given body and date is in this format.
+func (f *ReportFormat) Matches(content string, date time.Time) bool {
+	if f.Marker != "" && !strings.Contains(strings.ToLower(content), strings.ToLower(f.Marker)) {
+		return false
+	}
+	day := date.Format(dateFormat)
+	if f.From != "" && day < f.From {
+		return false
+	}
+	if f.Until != "" && day >= f.Until {
+		return false
+	}
+	return true
+}
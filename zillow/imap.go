@@ -0,0 +1,552 @@
+// Fetch report emails from Yahoo Mail (or another IMAP server, such as Gmail).
+package zillow
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// Address (or part of one) from which Zillow reports are sent.
+const defaultZillowSender = "zillow.com"
+
+const (
+	DefaultIMAPRetries    = 3
+	DefaultIMAPRetryDelay = 2 * time.Second
+)
+
+// How long to wait for the server to acknowledge a logout before dropping
+// the connection.
+const imapLogoutTimeout = 10 * time.Second
+
+// Maximum time to wait for each kind of IMAP operation; zero means no limit.
+type IMAPTimeouts struct {
+	Login  time.Duration // Includes connecting.
+	Search time.Duration // Includes selecting the mailbox.
+	Fetch  time.Duration
+}
+
+// How often to retry connecting and logging in, which fail transiently when
+// Yahoo drops the TLS handshake or rejects a login temporarily.
+type IMAPRetry struct {
+	Retries   int           // After the first attempt; negative means none.
+	BaseDelay time.Duration // Before the first retry; doubled for each one after.
+}
+
+// What to search for in the mailboxes.
+type IMAPSearch struct {
+	Mailboxes []string
+	Subject   string // Empty to match any subject.
+	Sender    string // Expected sender, used to detect a changed subject.
+	Since     time.Time
+	Before    time.Time // Zero for no upper bound.
+	CacheDir  string    // Where fetched emails are cached by UID; empty for none.
+	// Words to look for in the subjects of recent emails when none matches
+	// Subject, to list in the warning (default: "Listing Report").
+	SimilarSubjects []string
+	// The last UID recorded from each mailbox; a mailbox with one is
+	// searched for later UIDs, ignoring Since.
+	LastUIDs map[string]UIDState
+}
+
+// UIDState is the last UID recorded from a mailbox. UIDs are only comparable
+// within one UIDVALIDITY; if the server changes it, the date logic is used.
+type UIDState struct {
+	UIDValidity uint32 `json:"uid_validity"`
+	LastUID     uint32 `json:"last_uid"`
+}
+
+// IMAPClient is the part of a go-imap *client.Client that fetching uses, so
+// that a fetch can run against a fake server or a stub; see FetchEmailsWith.
+type IMAPClient interface {
+	Select(name string, readOnly bool) (*imap.MailboxStatus, error)
+	UidSearch(criteria *imap.SearchCriteria) ([]uint32, error)
+	UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error
+}
+
+// Set the limit on the following commands, for clients that have one.
+func setIMAPTimeout(c IMAPClient, timeout time.Duration) {
+	if cc, ok := c.(*client.Client); ok {
+		cc.Timeout = timeout
+	}
+}
+
+// Connect and log in to the IMAP server at addr (host:port).
+func dialIMAP(addr string, auth IMAPAuth, timeouts IMAPTimeouts) (*client.Client, error) {
+	// Connect to the IMAP server
+	dialer := &net.Dialer{Timeout: timeouts.Login}
+	tlsConfig := auth.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	c, err := client.DialWithDialerTLS(dialer, addr, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server %s: %v", addr, err)
+	}
+
+	// Login
+	c.Timeout = timeouts.Login
+	sendIMAPID(c, auth.ClientID)
+	if err := imapLogin(c, auth); err != nil {
+		LogoutIMAP(c)
+		return nil, fmt.Errorf("failed to login: %v", err)
+	}
+	return c, nil
+}
+
+// LogoutIMAP logs out and closes the connection, without waiting more than
+// imapLogoutTimeout for the server. A logout failure is only reported, since
+// by then the emails have been fetched or the run has already failed.
+func LogoutIMAP(c *client.Client) {
+	c.Timeout = imapLogoutTimeout
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Logout()
+	}()
+	select {
+	case err := <-done:
+		if err != nil && err != client.ErrAlreadyLoggedOut {
+			printf("Warning: IMAP logout failed: %v\n", err)
+		}
+	case <-time.After(imapLogoutTimeout):
+		printf("Warning: IMAP logout timed out after %v; closing the connection\n", imapLogoutTimeout)
+		c.Terminate()
+	}
+}
+
+// DialIMAP connects and logs in, retrying with exponential backoff.
+func DialIMAP(ctx context.Context, addr string, auth IMAPAuth, timeouts IMAPTimeouts, retry IMAPRetry) (*client.Client, error) {
+	delay := retry.BaseDelay
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c, err := dialIMAP(addr, auth, timeouts)
+		if err == nil {
+			LogEvent("imap_connected", "server", addr, "attempt", attempt+1)
+			if attempt > 0 {
+				printf("Connected to %s on retry %d\n", addr, attempt)
+			}
+			return c, nil
+		}
+		LogEvent("imap_connect_failed", "server", addr, "attempt", attempt+1, "error", err)
+		if attempt >= retry.Retries {
+			return nil, err
+		}
+		printf("IMAP attempt %d failed: %v; retrying in %v (retry %d of %d)\n",
+			attempt+1, err, delay, attempt+1, retry.Retries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// FetchEmails connects to the IMAP server at addr (host:port), logs in, and
+// fetches the emails in the mailboxes that match the search.
+func FetchEmails(ctx context.Context, addr string, auth IMAPAuth, timeouts IMAPTimeouts, retry IMAPRetry, search IMAPSearch) ([]*Email, error) {
+	c, err := DialIMAP(ctx, addr, auth, timeouts, retry)
+	if err != nil {
+		return nil, err
+	}
+	// go-imap has no context support, so drop the connection to unblock any
+	// command in progress when the run times out.
+	stop := context.AfterFunc(ctx, func() { c.Terminate() })
+	defer func() {
+		// Once the run has timed out the connection is gone.
+		if stop() {
+			LogoutIMAP(c)
+		}
+	}()
+	return FetchEmailsWith(c, timeouts, search)
+}
+
+// FetchEmailsWith fetches the emails matching the search over an
+// already logged-in client.
+func FetchEmailsWith(c IMAPClient, timeouts IMAPTimeouts, search IMAPSearch) ([]*Email, error) {
+	mailboxes := search.Mailboxes
+	if len(mailboxes) == 0 {
+		mailboxes = []string{"INBOX"}
+	}
+
+	// The same message can be in more than one mailbox (e.g. INBOX and
+	// Archive), so keep only the first copy of each Message-Id.
+	var emailMessages []*Email
+	seen := make(map[string]bool)
+	for _, mailbox := range mailboxes {
+		emails, err := fetchFromMailbox(c, timeouts, mailbox, search)
+		if err != nil {
+			return emailMessages, err
+		}
+		for _, email := range emails {
+			if email.MessageID != "" {
+				if seen[email.MessageID] {
+					printf("Email %s in %s was already found in another mailbox; skipping.\n",
+						email.MessageID, mailbox)
+					continue
+				}
+				seen[email.MessageID] = true
+			}
+			emailMessages = append(emailMessages, email)
+		}
+	}
+
+	if len(emailMessages) == 0 && search.Subject != "" {
+		warnIfSubjectChanged(c, mailboxes, search)
+	}
+
+	return emailMessages, nil
+}
+
+// Words searched for in subjects when no email matches the subject, unless
+// the search gives its own.
+var defaultSimilarSubjects = []string{"Listing Report"}
+
+// The most subjects listed when no email matched the subject.
+const maxSimilarSubjects = 10
+
+// When no emails matched the subject, check for recent unread emails from
+// the expected sender, and for recent emails with similar subjects. If there
+// are some, Zillow has probably changed the subject, and every run will
+// silently find nothing until it is updated.
+func warnIfSubjectChanged(c IMAPClient, mailboxes []string, search IMAPSearch) {
+	sender := search.Sender
+	if sender == "" {
+		sender = defaultZillowSender
+	}
+	timeSince := search.Since
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = timeSince
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	criteria.Header.Add("From", sender)
+
+	total := 0
+	for _, mailbox := range mailboxes {
+		if _, err := c.Select(mailbox, true); err != nil {
+			continue
+		}
+		uids, err := c.UidSearch(criteria)
+		if err != nil {
+			continue
+		}
+		total += len(uids)
+	}
+	subjects := similarSubjects(c, mailboxes, search)
+	if total == 0 && len(subjects) == 0 {
+		return
+	}
+	printf("********************************************************************\n")
+	if total > 0 {
+		printf("WARNING: No emails matched the subject, but %d unread emails from %s\n", total, sender)
+		printf("arrived since %s. Zillow may have changed the subject of its report;\n", timeSince.Format("2006-01-02"))
+	} else {
+		printf("WARNING: No emails matched the subject, but emails with similar subjects\n")
+		printf("arrived since %s. Zillow may have changed the subject of its report;\n", timeSince.Format("2006-01-02"))
+	}
+	printf("check a recent report and update email_subject in the config.\n")
+	if len(subjects) > 0 {
+		printf("Similar subjects found:\n")
+		for _, subject := range subjects {
+			printf("  %s\n", subject)
+		}
+	}
+	printf("********************************************************************\n")
+}
+
+// Return the distinct subjects of emails since the search date whose
+// subjects contain any of the search's similar subject words, most recent
+// first, up to maxSimilarSubjects.
+func similarSubjects(c IMAPClient, mailboxes []string, search IMAPSearch) []string {
+	words := search.SimilarSubjects
+	if len(words) == 0 {
+		words = defaultSimilarSubjects
+	}
+	var subjects []string
+	seen := make(map[string]bool)
+	for _, mailbox := range mailboxes {
+		if _, err := c.Select(mailbox, true); err != nil {
+			continue
+		}
+		for _, word := range words {
+			criteria := imap.NewSearchCriteria()
+			criteria.Since = search.Since
+			criteria.Header.Add("Subject", word)
+			uids, err := c.UidSearch(criteria)
+			if err != nil || len(uids) == 0 {
+				continue
+			}
+			if len(uids) > maxSimilarSubjects {
+				uids = uids[len(uids)-maxSimilarSubjects:]
+			}
+			uidset := new(imap.SeqSet)
+			uidset.AddNum(uids...)
+			messages, err := fetchMessages(c, uidset, []imap.FetchItem{imap.FetchEnvelope})
+			if err != nil {
+				continue
+			}
+			for i := len(messages) - 1; i >= 0; i-- {
+				msg := messages[i]
+				if msg.Envelope == nil || seen[msg.Envelope.Subject] || len(subjects) >= maxSimilarSubjects {
+					continue
+				}
+				seen[msg.Envelope.Subject] = true
+				subjects = append(subjects, msg.Envelope.Subject)
+			}
+		}
+	}
+	return subjects
+}
+
+// Select a mailbox and fetch the emails in it matching the search.
+func fetchFromMailbox(c IMAPClient, timeouts IMAPTimeouts, mailbox string, search IMAPSearch) ([]*Email, error) {
+	timeSince := search.Since
+	since := timeSince.Format("2006-01-02")
+
+	setIMAPTimeout(c, timeouts.Search)
+	// Read-only, and fetched with BODY.PEEK below, so that fetching leaves
+	// emails unread; MarkProcessed marks those that were recorded.
+	status, err := c.Select(mailbox, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select %s: %v", mailbox, err)
+	}
+	// A count far from what's expected suggests a filter is misrouting mail.
+	printf("Selected mailbox %s (%d messages)\n", mailbox, status.Messages)
+
+	// SINCE and BEFORE are dates, which the server compares in its own
+	// timezone, so widen them by a day to not miss an email near local
+	// midnight; inSearchWindow then applies the exact local boundaries.
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = timeSince.AddDate(0, 0, -1)
+	if !search.Before.IsZero() {
+		criteria.Before = search.Before.AddDate(0, 0, 1)
+	}
+	if search.Subject != "" {
+		criteria.Header.Add("Subject", search.Subject) // Add subject search
+	}
+	last, afterUID := search.LastUIDs[mailbox]
+	if afterUID && last.UIDValidity != status.UidValidity {
+		printf("UIDVALIDITY of %s has changed; searching by date\n", mailbox)
+		afterUID = false
+	}
+	if afterUID {
+		printf("Searching %s for UIDs after %d, the last recorded\n", mailbox, last.LastUID)
+		criteria.Since = time.Time{}
+		criteria.Uid = new(imap.SeqSet)
+		criteria.Uid.AddRange(last.LastUID+1, 0)
+		search.Since = time.Time{}
+		since = fmt.Sprintf("UID %d", last.LastUID)
+	}
+
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %v", err)
+	}
+	if afterUID {
+		// "n:*" always matches the highest UID, even if it is below n.
+		var later []uint32
+		for _, uid := range uids {
+			if uid > last.LastUID {
+				later = append(later, uid)
+			}
+		}
+		uids = later
+	}
+
+	if len(uids) == 0 {
+		return []*Email{}, nil
+	}
+
+	if search.Subject != "" {
+		printf("Found %d emails in %s with subject %q since %s\n", len(uids), mailbox, search.Subject, since)
+	} else {
+		printf("Found %d emails in %s since %s\n", len(uids), mailbox, since)
+	}
+
+	// Emails fetched on an earlier run are read from the cache instead.
+	var emailMessages []*Email
+	var toFetch []uint32
+	for _, uid := range uids {
+		if search.CacheDir != "" {
+			if email, err := loadCachedEmail(emailCachePath(search.CacheDir, mailbox, status.UidValidity, uid), uid); err == nil {
+				if inSearchWindow(email.Date, search) {
+					email.Mailbox, email.UIDValidity, email.UID = mailbox, status.UidValidity, uid
+					emailMessages = append(emailMessages, email)
+				}
+				continue
+			}
+		}
+		toFetch = append(toFetch, uid)
+	}
+	if search.CacheDir != "" {
+		printf("Read %d emails from the cache; fetching %d\n", len(uids)-len(toFetch), len(toFetch))
+	}
+	if len(toFetch) == 0 {
+		return emailMessages, nil
+	}
+	uidset := new(imap.SeqSet)
+	uidset.AddNum(toFetch...)
+
+	// Fetch the envelopes and MIME structure first, then only the text part
+	// of each message, so that images and attachments are never downloaded.
+	setIMAPTimeout(c, timeouts.Fetch)
+	messages, err := fetchMessages(c, uidset, []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchBodyStructure})
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %v", err)
+	}
+
+	var fetched []*Email
+	byUID := make(map[uint32]*Email)
+	textParts := make(map[uint32]*imap.BodyStructure)
+	sections := make(map[string]*imap.SeqSet) // UID sets keyed by part path.
+	paths := make(map[string][]int)
+	for _, msg := range messages {
+		if msg.Envelope == nil {
+			continue
+		}
+		if !inSearchWindow(msg.Envelope.Date, search) {
+			continue
+		}
+
+		email := &Email{
+			Subject:      msg.Envelope.Subject,
+			Date:         msg.Envelope.Date,
+			ReceivedDate: msg.InternalDate,
+			ID:           fmt.Sprintf("%d", msg.Uid),
+			MessageID:    msg.Envelope.MessageId,
+			Mailbox:      mailbox,
+			UIDValidity:  status.UidValidity,
+			UID:          msg.Uid,
+		}
+		fetched = append(fetched, email)
+		byUID[msg.Uid] = email
+
+		// Messages without a recognizable text part are fetched whole.
+		key := ""
+		if path, part := findTextPart(msg.BodyStructure); part != nil {
+			key = fmt.Sprint(path)
+			paths[key] = path
+			textParts[msg.Uid] = part
+		}
+		if sections[key] == nil {
+			sections[key] = new(imap.SeqSet)
+		}
+		sections[key].AddNum(msg.Uid)
+	}
+
+	for key, set := range sections {
+		// With no path, this is BODY.PEEK[], the whole message.
+		section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: paths[key]}, Peek: true}
+		bodies, err := fetchMessages(c, set, []imap.FetchItem{section.FetchItem()})
+		if err != nil {
+			return append(emailMessages, fetched...), fmt.Errorf("fetch failed: %v", err)
+		}
+		for _, msg := range bodies {
+			email := byUID[msg.Uid]
+			if email == nil {
+				continue
+			}
+			// Read body content
+			for _, r := range msg.Body {
+				if b, err := ioutil.ReadAll(r); err == nil {
+					email.Content = string(b)
+					break
+				}
+			}
+			if part := textParts[msg.Uid]; part != nil {
+				email.Content = textPartMessage(email.Subject, part, email.Content)
+			}
+		}
+	}
+
+	if search.CacheDir != "" {
+		for uid, email := range byUID {
+			if err := saveCachedEmail(emailCachePath(search.CacheDir, mailbox, status.UidValidity, uid), email); err != nil {
+				printf("Warning: unable to cache email %d: %v\n", uid, err)
+			}
+		}
+	}
+	return append(emailMessages, fetched...), nil
+}
+
+// Report whether an email dated date falls in the search window.
+func inSearchWindow(date time.Time, search IMAPSearch) bool {
+	// For some reason, Yahoo Mail can return emails with a date prior to the requested date - even
+	// when you take UTC into account. So account for that here.
+	if date.Before(search.Since) {
+		printf("Email with stamp %s is older than filter date %s; skipping.\n",
+			date.Format("2006-01-02"), search.Since.Format("2006-01-02"))
+		return false
+	}
+	if !search.Before.IsZero() && !date.Before(search.Before) {
+		printf("Email with stamp %s is not before %s; skipping.\n",
+			date.Format("2006-01-02"), search.Before.Format("2006-01-02"))
+		return false
+	}
+	return true
+}
+
+// Fetch the given items for the messages with the UIDs in uidset.
+func fetchMessages(c IMAPClient, uidset *imap.SeqSet, items []imap.FetchItem) ([]*imap.Message, error) {
+	ch := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(uidset, items, ch)
+	}()
+	// go-imap closes ch when the fetch ends, even on error, so this drains
+	// it and the goroutine can't be left blocked.
+	var messages []*imap.Message
+	for msg := range ch {
+		messages = append(messages, msg)
+	}
+	return messages, <-done
+}
+
+// Return the path and structure of the text/plain part of a message, or
+// else of its text/html part, or a nil part if it has neither.
+func findTextPart(bs *imap.BodyStructure) (path []int, part *imap.BodyStructure) {
+	if bs == nil {
+		return nil, nil
+	}
+	var htmlPath []int
+	var htmlPart *imap.BodyStructure
+	bs.Walk(func(p []int, s *imap.BodyStructure) bool {
+		if !strings.EqualFold(s.MIMEType, "text") || strings.EqualFold(s.Disposition, "attachment") {
+			return true
+		}
+		switch {
+		case strings.EqualFold(s.MIMESubType, "plain") && part == nil:
+			path, part = p, s
+		case strings.EqualFold(s.MIMESubType, "html") && htmlPart == nil:
+			htmlPath, htmlPart = p, s
+		}
+		return true
+	})
+	if part == nil {
+		return htmlPath, htmlPart
+	}
+	return path, part
+}
+
+// Wrap the raw body of a single text part in enough of a message for
+// MessageText to decode it, with the subject for ExtractPropertyAddress.
+func textPartMessage(subject string, part *imap.BodyStructure, body string) string {
+	params := map[string]string{}
+	if charset, ok := part.Params["charset"]; ok {
+		params["charset"] = charset
+	}
+	contentType := mime.FormatMediaType(strings.ToLower(part.MIMEType+"/"+part.MIMESubType), params)
+	return "Subject: " + subject + "\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Transfer-Encoding: " + part.Encoding + "\r\n" +
+		"\r\n" + body
+}
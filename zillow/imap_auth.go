@@ -0,0 +1,109 @@
+// Authenticate to an IMAP server, trying each configured method in turn.
+package zillow
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+	"golang.org/x/oauth2"
+)
+
+const (
+	AuthMethodAppPassword = "app_password"
+	AuthMethodOAuth2      = "oauth2"
+)
+
+// IMAPAuth holds the credentials and methods used to log in to IMAP, and
+// the TLS settings for the connection.
+type IMAPAuth struct {
+	Username       string
+	Password       string
+	Methods        []string // In the order to attempt; defaults to app password only.
+	OAuthTokenFile string   // JSON OAuth2 token used for XOAUTH2.
+	AccessToken    string   // Used for XOAUTH2 instead of OAuthTokenFile, if set.
+	// Sent with the ID command before logging in, if the server supports
+	// it, e.g. {"name": "zillowsaves", "version": "1.2.0"}; nil for none.
+	ClientID map[string]string
+	// For the TLS connection, e.g. with a custom CA; nil for the system
+	// roots and the host name in the address.
+	TLSConfig *tls.Config
+}
+
+// xoauth2Client implements the XOAUTH2 SASL mechanism used by Yahoo, Gmail,
+// and Outlook. go-sasl provides only the standardized OAUTHBEARER.
+type xoauth2Client struct {
+	username    string
+	accessToken string
+}
+
+func (a *xoauth2Client) Start() (mech string, ir []byte, err error) {
+	ir = []byte("user=" + a.username + "\x01auth=Bearer " + a.accessToken + "\x01\x01")
+	return "XOAUTH2", ir, nil
+}
+
+func (a *xoauth2Client) Next(challenge []byte) (response []byte, err error) {
+	// On failure the server sends a JSON error as a challenge; an empty
+	// response lets it complete the exchange with a NO.
+	return []byte{}, nil
+}
+
+func newXoauth2Client(username, accessToken string) sasl.Client {
+	return &xoauth2Client{username: username, accessToken: accessToken}
+}
+
+// Log in using a single authentication method.
+func imapLoginWith(c *client.Client, auth IMAPAuth, method string) error {
+	switch method {
+	case AuthMethodAppPassword:
+		return c.Login(auth.Username, auth.Password)
+	case AuthMethodOAuth2:
+		if auth.AccessToken != "" {
+			return c.Authenticate(newXoauth2Client(auth.Username, auth.AccessToken))
+		}
+		if auth.OAuthTokenFile == "" {
+			return fmt.Errorf("no imap_oauth_token_file or imap_oauth_credentials_file configured")
+		}
+		tok, err := readToken(auth.OAuthTokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to read OAuth token: %v", err)
+		}
+		return c.Authenticate(newXoauth2Client(auth.Username, tok.AccessToken))
+	default:
+		return fmt.Errorf("unknown auth method %q", method)
+	}
+}
+
+// Log in to the IMAP server, trying each configured method until one succeeds.
+func imapLogin(c *client.Client, auth IMAPAuth) error {
+	methods := auth.Methods
+	if len(methods) == 0 {
+		methods = []string{AuthMethodAppPassword}
+	}
+
+	var failures []string
+	for _, method := range methods {
+		err := imapLoginWith(c, auth, method)
+		if err == nil {
+			printf("Logged in to IMAP using %s\n", method)
+			return nil
+		}
+		printf("IMAP login using %s failed: %v\n", method, err)
+		failures = append(failures, fmt.Sprintf("%s: %v", method, err))
+	}
+	return fmt.Errorf("all auth methods failed (%s)", strings.Join(failures, "; "))
+}
+
+// Read an OAuth2 token saved as JSON.
+func readToken(file string) (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{}
+	return tok, json.Unmarshal(b, tok)
+}
@@ -0,0 +1,46 @@
+// Identify the client to the IMAP server with the ID command (RFC 2971), so
+// that its logins are recognizable in the provider's security logs.
+package zillow
+
+import (
+	"sort"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// An ID command with the given fields, e.g. "name" and "version".
+type idCommand struct {
+	fields map[string]string
+}
+
+func (cmd *idCommand) Command() *imap.Command {
+	keys := make([]string, 0, len(cmd.fields))
+	for key := range cmd.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []interface{}
+	for _, key := range keys {
+		params = append(params, key, cmd.fields[key])
+	}
+	return &imap.Command{Name: "ID", Arguments: []interface{}{params}}
+}
+
+// Send the ID command with the given fields, if there are any and the server
+// supports it. A failure is only reported, since it doesn't stop the login.
+func sendIMAPID(c *client.Client, fields map[string]string) {
+	if len(fields) == 0 {
+		return
+	}
+	if ok, err := c.Support("ID"); err != nil || !ok {
+		return
+	}
+	status, err := c.Execute(&idCommand{fields}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		printf("Warning: IMAP ID command failed: %v\n", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Decode the text of a raw RFC822 message, so that extraction sees the
+// words and numbers of the report rather than MIME structure and markup.
+package zillow
+
+import (
+	"encoding/base64"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Return the text of a raw message: its text/plain part if it has one,
+// otherwise its text/html part with the markup stripped. Transfer encodings
+// and non-UTF-8 charsets are decoded. If the message has neither, the raw content is returned.
+func MessageText(raw string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return raw
+	}
+	plain, htmlText := findTextParts(textproto.MIMEHeader(msg.Header), msg.Body)
+	switch {
+	case plain != "":
+		return plain
+	case htmlText != "":
+		return stripHTML(htmlText)
+	}
+	return raw
+}
+
+// Return the first text/plain and text/html parts within a (possibly
+// multipart) body, decoded.
+func findTextParts(header textproto.MIMEHeader, body io.Reader) (plain, htmlText string) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045: a missing or invalid Content-Type means plain text.
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextRawPart leaves decoding to us, for every transfer encoding alike.
+			part, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			p, h := findTextParts(part.Header, part)
+			if plain == "" {
+				plain = p
+			}
+			if htmlText == "" {
+				htmlText = h
+			}
+		}
+		return plain, htmlText
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", ""
+	}
+	decoded := decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	data, err := ioutil.ReadAll(decodeCharset(params["charset"], decoded))
+	if err != nil {
+		return "", ""
+	}
+	if mediaType == "text/html" {
+		return "", string(data)
+	}
+	return string(data), ""
+}
+
+// Wrap body in a reader that undoes the given Content-Transfer-Encoding.
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
+
+// Wrap body in a reader that converts the given charset to UTF-8. Unknown
+// charsets are passed through, as are UTF-8 and US-ASCII.
+func decodeCharset(charset string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return body
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return body
+	}
+	return enc.NewDecoder().Reader(body)
+}
+
+var (
+	htmlHiddenRegex = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+	htmlBreakRegex  = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h\d)\b[^>]*>`)
+	htmlTagRegex    = regexp.MustCompile(`<[^>]*>`)
+	spaceRunRegex   = regexp.MustCompile(`[ \t\x{a0}]+`)
+)
+
+// Reduce HTML to its text. Tags become spaces, so that a number and its
+// label in separate elements (e.g. "<td>12</td><td>saves</td>") read as
+// "12 saves", and block-level tags become line breaks.
+func stripHTML(s string) string {
+	s = htmlHiddenRegex.ReplaceAllString(s, "")
+	s = htmlBreakRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceRunRegex.ReplaceAllString(line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
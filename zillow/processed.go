@@ -0,0 +1,75 @@
+// Mark emails whose data has been recorded, so the mailbox shows what has
+// been processed.
+package zillow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/emersion/go-imap"
+)
+
+// MarkProcessed connects to the IMAP server at addr and flags the emails
+// \Seen, then, if moveTo isn't empty, moves them to that mailbox. Emails
+// not fetched over IMAP, or whose mailbox's UIDVALIDITY has changed since,
+// are left alone.
+func MarkProcessed(ctx context.Context, addr string, auth IMAPAuth, timeouts IMAPTimeouts, retry IMAPRetry, emails []*Email, moveTo string) error {
+	byMailbox := make(map[string][]*Email)
+	var mailboxes []string
+	for _, email := range emails {
+		if email.UID == 0 || email.Mailbox == "" {
+			continue
+		}
+		if byMailbox[email.Mailbox] == nil {
+			mailboxes = append(mailboxes, email.Mailbox)
+		}
+		byMailbox[email.Mailbox] = append(byMailbox[email.Mailbox], email)
+	}
+	if len(mailboxes) == 0 {
+		return nil
+	}
+
+	c, err := DialIMAP(ctx, addr, auth, timeouts, retry)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { c.Terminate() })
+	defer func() {
+		if stop() {
+			LogoutIMAP(c)
+		}
+	}()
+
+	c.Timeout = timeouts.Fetch
+	for _, mailbox := range mailboxes {
+		status, err := c.Select(mailbox, false)
+		if err != nil {
+			return fmt.Errorf("failed to select %s: %v", mailbox, err)
+		}
+		uidset := new(imap.SeqSet)
+		for _, email := range byMailbox[mailbox] {
+			if email.UIDValidity == status.UidValidity {
+				uidset.AddNum(email.UID)
+			}
+		}
+		if uidset.Empty() {
+			printf("UIDVALIDITY of %s has changed; not marking its emails\n", mailbox)
+			continue
+		}
+		item := imap.FormatFlagsOp(imap.AddFlags, true)
+		if err := c.UidStore(uidset, item, []interface{}{imap.SeenFlag}, nil); err != nil {
+			return fmt.Errorf("failed to mark emails in %s as read: %v", mailbox, err)
+		}
+		if moveTo == "" || moveTo == mailbox {
+			printf("Marked %s in %s as read\n", uidset, mailbox)
+			LogEvent("emails_marked", "mailbox", mailbox, "uids", uidset.String())
+			continue
+		}
+		if err := c.UidMove(uidset, moveTo); err != nil {
+			return fmt.Errorf("failed to move emails from %s to %s: %v", mailbox, moveTo, err)
+		}
+		printf("Marked %s in %s as read and moved them to %s\n", uidset, mailbox, moveTo)
+		LogEvent("emails_moved", "mailbox", mailbox, "uids", uidset.String(), "to", moveTo)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Package zillow fetches Zillow listing report emails over IMAP and extracts
+// the figures in them (saves, contacts, shares, and price per square foot).
+// It is the library behind the zillowsaves command, which records the
+// figures in a Google Sheet.
+package zillow
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Layout of the YYYY-MM-DD dates in report formats.
+const dateFormat = "2006-01-02"
+
+// LogEvent is called with the main events of a fetch, e.g.
+// LogEvent("imap_connected", "server", addr, "attempt", 1), as key/value
+// pairs. It does nothing unless set.
+var LogEvent = func(event string, keyValues ...interface{}) {}
+
+// Output receives the progress messages and warnings of a fetch, such as
+// the mailboxes searched and the emails skipped. They are discarded unless
+// it is set.
+var Output io.Writer = io.Discard
+
+// Write a message to Output.
+func printf(format string, args ...interface{}) {
+	fmt.Fprintf(Output, format, args...)
+}
+
+// Email is a Zillow report email, with the figures extracted from it.
+type Email struct {
+	Subject      string
+	Date         time.Time
+	ReceivedDate time.Time // When the server received the message (IMAP INTERNALDATE).
+	Content      string    // The raw message; when fetched, just its text part and a few headers.
+	Text         string    // Decoded body text, used for extraction; see MessageText.
+	ID           string
+	MessageID    string // From the envelope; stable across mailboxes.
+	Account      string // Name of the account it was fetched from, if several are configured.
+	Mailbox      string // Where it was fetched from, with its UIDVALIDITY and UID.
+	UIDValidity  uint32
+	UID          uint32
+	ZillowSaves  int
+	Contacts     int
+	PricePerSqFt int
+	Shares       int
+	Address      string // Street address of the property, from the body.
+	NoData       bool   // No saves count was found; recorded with -force.
+	Extracted    bool   // Its data was extracted, and it may be recorded.
+	Format       string // Name of the detected ReportFormat.
+}